@@ -9,9 +9,9 @@ import (
 	"log/slog"
 	"math"
 	"os"
-	"runtime"
-	"strconv"
+	"strings"
 	"sync"
+	"unicode"
 )
 
 // ActionsLog is a log level in GitHub Actions.
@@ -27,6 +27,8 @@ func (a ActionsLog) String() string {
 		return "warning"
 	case LogError:
 		return "error"
+	case LogPlain:
+		return "plain"
 	default:
 		panic("invalid ActionsLog")
 	}
@@ -37,6 +39,10 @@ const (
 	LogNotice
 	LogWarn
 	LogError
+
+	// LogPlain writes the record as plain log lines instead of a workflow command. Lines that the runner
+	// would otherwise interpret as workflow commands are prefixed with a zero-width space.
+	LogPlain
 )
 
 // DefaultActionsLog is the default mapping from slog.Level to ActionsLog.
@@ -63,10 +69,49 @@ type Wrapper struct {
 	// Actions expects. Output should not be changed after the Wrapper is created.
 	Output io.Writer
 
+	// Mode determines whether the Wrapper formats its output for GitHub Actions. Defaults to ModeActions.
+	// Mode should not be changed after the Wrapper is created.
+	Mode Mode
+
+	// LocalOutput is the io.Writer that the Handler writes to when Mode resolves to ModeLocal. Defaults to
+	// os.Stderr. LocalOutput should not be changed after the Wrapper is created.
+	LocalOutput io.Writer
+
 	// AddSource causes the Wrapper to compute the source code position
 	// of the log statement so that it can be linked from the GitHub Actions UI.
 	AddSource bool
 
+	// Workspace is the directory that source file paths are made relative to when AddSource is set.
+	// Defaults to the GITHUB_WORKSPACE environment variable. When neither is set, file paths are
+	// written as-is. Source files outside of Workspace are written without a location because
+	// GitHub can't link to them. Workspace should not be changed after the Wrapper is created.
+	Workspace string
+
+	// StopCommands causes the Wrapper to surround plain log lines with ::stop-commands:: and a matching
+	// resume command so that the runner won't process any workflow commands in them, and the lines are
+	// written exactly as the Handler wrote them. Without it, lines that look like workflow commands are
+	// prefixed with a zero-width space. The token is randomly generated for each root Wrapper. Annotations
+	// don't need this protection because their content is escaped onto a single line.
+	// StopCommands should not be changed after the Wrapper is created.
+	StopCommands bool
+
+	// AnnotationLimit is the maximum number of annotations of each kind the Wrapper will write. GitHub only
+	// shows 10 notices, 10 warnings and 10 errors per step and silently drops the rest. Once the limit
+	// for a kind is reached, further records of that kind are written as plain log lines instead. Debug
+	// messages aren't annotations, so they aren't limited. Zero means no limit. See ReportSuppressed.
+	// AnnotationLimit should not be changed after the Wrapper is created.
+	AnnotationLimit int
+
+	// FailOnWarning causes Failed to report warnings as failures in addition to errors. See ExitCode.
+	// FailOnWarning should not be changed after the Wrapper is created.
+	FailOnWarning bool
+
+	// PathRewrites are rules for mapping source file paths to paths in the repository. The first matching
+	// rule is used. When no rule matches, a rule that strips the main module's path is tried. That rule
+	// handles binaries built with -trimpath when the main module is at the root of the repository.
+	// PathRewrites should not be changed after the Wrapper is created.
+	PathRewrites []PathRewrite
+
 	// Level sets the level for the Wrapper itself. If it is set, the Wrapper will only pass through logs that
 	// are at or above this level. Handler may have its own level set as well. It is probably advisable
 	// to either set it on the Wrapper or the Handler but not both.
@@ -76,10 +121,34 @@ type Wrapper struct {
 	// an example of a custom ActionsLogger.
 	ActionsLogger func(level slog.Level) ActionsLog
 
+	// RecordActionsLogger maps a record to an ActionsLog and Properties for its annotation. When it is set,
+	// ActionsLogger is not used. groups are the names passed to WithGroup. attrs are the attributes passed
+	// to WithAttrs with any that were added after WithGroup wrapped in their groups. The returned Properties'
+	// non-zero fields override Properties from attributes. See ExampleWrapper_recordActionsLogger.
+	RecordActionsLogger func(groups []string, attrs []slog.Attr, record slog.Record) (ActionsLog, Properties)
+
 	parent *Wrapper
 
-	// only the root's buf is used.
-	buf *[]byte
+	// annotation holds the Properties and Location from attributes added with WithAttrs.
+	annotation annotationAttrs
+
+	// secrets are the values of Secrets from attributes added with WithAttrs.
+	secrets []string
+
+	// groups and attrs are what was added with WithGroup and WithAttrs. They are passed to RecordActionsLogger.
+	groups []string
+	attrs  []slog.Attr
+
+	// only the root's buf, plainBuf and writer are used.
+	buf      *[]byte
+	plainBuf *[]byte
+	writer   *escapeWriter
+
+	// workspace is the resolved Workspace. Only the root's workspace is used.
+	workspace string
+
+	// local is true when Mode resolves to ModeLocal. Only the root's local is used.
+	local bool
 
 	// handler should only be accessed by withLock().
 	handler slog.Handler
@@ -87,6 +156,22 @@ type Wrapper struct {
 	// mux should only be accessed on the root Wrapper.
 	mux sync.Mutex
 
+	// logGroups is the stack of open log groups. Only the root's logGroups are used.
+	logGroups []*logGroup
+
+	// stopToken is the token for ::stop-commands::. Only the root's stopToken is used.
+	stopToken string
+
+	// annotations and suppressed count annotations by kind. Only the root's are used.
+	annotations map[ActionsLog]int
+	suppressed  map[ActionsLog]int
+
+	// stats counts handled records by the kind they were mapped to. Only the root's stats are used.
+	stats map[ActionsLog]int
+
+	// masked is the set of values that have been written with ::add-mask::. Only the root's masked is used.
+	masked map[string]struct{}
+
 	initOnce sync.Once
 }
 
@@ -98,14 +183,41 @@ func (w *Wrapper) init() {
 		}
 		buf := make([]byte, 0, 1024)
 		w.buf = &buf
+		plainBuf := make([]byte, 0, 1024)
+		w.plainBuf = &plainBuf
+		w.writer = &escapeWriter{buf: w.buf}
+		w.workspace = w.Workspace
+		if w.workspace == "" {
+			w.workspace = os.Getenv("GITHUB_WORKSPACE")
+		}
 		handler := w.Handler
 		if handler == nil {
 			handler = DefaultHandler
 		}
-		w.handler = handler(&escapeWriter{buf: w.buf})
+		w.local = w.Mode.isLocal()
+		if w.local {
+			localOutput := w.LocalOutput
+			if localOutput == nil {
+				localOutput = os.Stderr
+			}
+			w.handler = handler(localOutput)
+			return
+		}
+		w.handler = handler(w.writer)
+		if ch, ok := w.handler.(colorHandler); ok {
+			w.writer.stripColor = ch.ColorEnabled()
+		}
 	})
 }
 
+func (w *Wrapper) root() *Wrapper {
+	root := w
+	for root.parent != nil {
+		root = root.parent
+	}
+	return root
+}
+
 func (w *Wrapper) Enabled(ctx context.Context, level slog.Level) bool {
 	w.init()
 	if w.Level != nil {
@@ -118,44 +230,42 @@ func (w *Wrapper) Enabled(ctx context.Context, level slog.Level) bool {
 
 func (w *Wrapper) Handle(ctx context.Context, record slog.Record) error {
 	w.init()
-	levelLog := w.ActionsLogger
-	if levelLog == nil {
-		levelLog = DefaultActionsLog
-	}
-	actionsLog := levelLog(record.Level)
-	root := w
-	for root.parent != nil {
-		root = root.parent
+	annotation, record := recordAnnotationAttrs(w.annotation, record)
+	root := w.root()
+	actionsLog, recordProps := w.actionsLog(record)
+	if root.local {
+		root.mux.Lock()
+		root.count(actionsLog)
+		root.mux.Unlock()
+		return w.handler.Handle(ctx, record)
 	}
+	annotation.properties = annotation.properties.merge(recordProps)
+	secrets := w.secrets[:len(w.secrets):len(w.secrets)]
+	record.Attrs(func(attr slog.Attr) bool {
+		secrets = appendSecrets(secrets, attr)
+		return true
+	})
 	root.mux.Lock()
 	defer root.mux.Unlock()
-	output := root.Output
-	if output == nil {
-		output = os.Stdout
+	root.count(actionsLog)
+	err := root.writeMasks(secrets)
+	if err != nil {
+		return err
 	}
 
 	*root.buf = (*root.buf)[:0]
-	*root.buf = append(*root.buf, "::"+actionsLog.String()+" "...)
-	if w.AddSource {
-		frames := runtime.CallersFrames([]uintptr{record.PC})
-		frame, _ := frames.Next()
-		if frame.File != "" {
-			*root.buf = append(*root.buf, "file="...)
-			*root.buf = append(*root.buf, frame.File...)
-			if frame.Line > 0 {
-				*root.buf = append(*root.buf, ',')
-			}
-		}
-		if frame.Line > 0 {
-			*root.buf = append(*root.buf, "line="...)
-			*root.buf = strconv.AppendInt(*root.buf, int64(frame.Line), 10)
-		}
+	plain := actionsLog == LogPlain || root.overLimit(actionsLog)
+	root.writer.raw = plain
+	if !plain {
+		*root.buf = w.appendCommandPrefix(*root.buf, actionsLog, record, annotation)
 	}
-	*root.buf = append(*root.buf, "::"...)
-	err := w.handler.Handle(ctx, record)
+	err = w.handler.Handle(ctx, record)
 	if err != nil {
 		return err
 	}
+	if plain {
+		return root.writePlain(*root.buf)
+	}
 	// remove trailing "%0A" and "%0D" from the buffer
 	for {
 		lb := len(*root.buf)
@@ -171,61 +281,302 @@ func (w *Wrapper) Handle(ctx context.Context, record slog.Record) error {
 		*root.buf = (*root.buf)[:lb-3]
 	}
 	*root.buf = append(*root.buf, '\n')
-	_, err = io.WriteString(output, string(*root.buf))
+	_, err = io.WriteString(root.output(), string(*root.buf))
+	return err
+}
+
+// actionsLog returns the ActionsLog and Properties for record from RecordActionsLogger or ActionsLogger.
+func (w *Wrapper) actionsLog(record slog.Record) (ActionsLog, Properties) {
+	if w.RecordActionsLogger != nil {
+		return w.RecordActionsLogger(w.groups, w.attrs, record)
+	}
+	levelLog := w.ActionsLogger
+	if levelLog == nil {
+		levelLog = DefaultActionsLog
+	}
+	return levelLog(record.Level), Properties{}
+}
+
+// appendCommandPrefix appends "::<command> <properties>::" for record to dst.
+func (w *Wrapper) appendCommandPrefix(dst []byte, actionsLog ActionsLog, record slog.Record, annotation annotationAttrs) []byte {
+	dst = append(dst, "::"+actionsLog.String()+" "...)
+	start := len(dst)
+	props := annotation.properties
+	switch loc := annotation.location; {
+	case loc != Location{}:
+		file, ok := w.locationFile(loc.File)
+		if ok {
+			dst = appendProperty(dst, start, "file", file)
+			dst = appendIntProperty(dst, start, "line", loc.Line)
+		}
+		props = Properties{Col: loc.Col, EndLine: loc.EndLine, EndColumn: loc.EndColumn}.merge(props)
+	case w.AddSource:
+		frame := w.recordFrame(record)
+		if frame.File != "" {
+			dst = appendProperty(dst, start, "file", frame.File)
+		}
+		dst = appendIntProperty(dst, start, "line", frame.Line)
+	}
+	dst = appendIntProperty(dst, start, "col", props.Col)
+	dst = appendIntProperty(dst, start, "endLine", props.EndLine)
+	dst = appendIntProperty(dst, start, "endColumn", props.EndColumn)
+	if title := strings.TrimSpace(props.Title); title != "" {
+		dst = appendProperty(dst, start, "title", title)
+	}
+	return append(dst, "::"...)
+}
+
+// writeLines writes p to the output as plain log lines the same way writePlain does.
+func (w *Wrapper) writeLines(p []byte) error {
+	w.init()
+	root := w.root()
+	root.mux.Lock()
+	defer root.mux.Unlock()
+	return root.writePlain(p)
+}
+
+// writePlain writes p to the output as plain log lines. Lines that the runner would interpret as
+// workflow commands are prefixed with a zero-width space so that they are written as-is. When
+// StopCommands is set, the lines are surrounded with stop-commands instead, and only lines that would
+// resume command processing are prefixed. The runner looks for legacy "##[" commands anywhere in a
+// line, so a zero-width space is added after every "##". Only call writePlain on the root Wrapper while
+// holding its mux.
+func (w *Wrapper) writePlain(p []byte) error {
+	p = bytes.TrimRight(p, "\r\n")
+	*w.plainBuf = (*w.plainBuf)[:0]
+	resume := ""
+	unsafePrefixes := []string{"::"}
+	if w.StopCommands {
+		if w.stopToken == "" {
+			token, err := randomToken()
+			if err != nil {
+				return err
+			}
+			w.stopToken = token
+		}
+		resume = "::" + w.stopToken + "::"
+		unsafePrefixes = []string{"::" + w.stopToken}
+		*w.plainBuf = append(*w.plainBuf, "::stop-commands::"+w.stopToken+"\n"...)
+	}
+	for len(p) > 0 {
+		// The runner splits lines on "\r" as well as "\n".
+		line := p
+		i := bytes.IndexAny(p, "\r\n")
+		if i >= 0 {
+			line = p[:i+1]
+			if bytes.HasPrefix(p[i:], []byte("\r\n")) {
+				line = p[:i+2]
+			}
+		}
+		p = p[len(line):]
+		if looksLikeCommand(line, unsafePrefixes...) {
+			*w.plainBuf = append(*w.plainBuf, zeroWidthSpace...)
+		}
+		*w.plainBuf = appendLegacySafe(*w.plainBuf, line)
+	}
+	*w.plainBuf = append(*w.plainBuf, '\n')
+	*w.plainBuf = append(*w.plainBuf, resume...)
+	if resume != "" {
+		*w.plainBuf = append(*w.plainBuf, '\n')
+	}
+	_, err := io.WriteString(w.output(), string(*w.plainBuf))
+	return err
+}
+
+const zeroWidthSpace = "\u200b"
+
+// appendLegacySafe appends line to dst with a zero-width space between the "##" and "[" of anything that
+// the runner would parse as a legacy "##[command]" workflow command.
+func appendLegacySafe(dst, line []byte) []byte {
+	for {
+		i := bytes.Index(line, []byte("##["))
+		if i < 0 {
+			return append(dst, line...)
+		}
+		dst = append(dst, line[:i+2]...)
+		dst = append(dst, zeroWidthSpace...)
+		line = line[i+2:]
+	}
+}
+
+// looksLikeCommand returns true if line would be parsed as a workflow command that starts with one of
+// prefixes.
+func looksLikeCommand(line []byte, prefixes ...string) bool {
+	line = bytes.TrimLeftFunc(line, unicode.IsSpace)
+	for _, prefix := range prefixes {
+		if bytes.HasPrefix(line, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// output returns the Writer to write to. Only call output on the root Wrapper.
+func (w *Wrapper) output() io.Writer {
+	if w.Output == nil {
+		return os.Stdout
+	}
+	return w.Output
+}
+
+// writeCommand writes a workflow command to the output. keysAndValues are alternating property
+// keys and values. The caller must hold the root's mux.
+func (w *Wrapper) writeCommand(name, data string, keysAndValues ...string) error {
+	line := make([]byte, 0, len(name)+len(data)+5)
+	line = append(line, "::"+name...)
+	if len(keysAndValues) > 1 {
+		line = append(line, ' ')
+		start := len(line)
+		for i := 0; i+1 < len(keysAndValues); i += 2 {
+			line = appendProperty(line, start, keysAndValues[i], keysAndValues[i+1])
+		}
+	}
+	line = append(line, "::"...)
+	line = appendEscapedData(line, data)
+	line = append(line, '\n')
+	_, err := w.root().output().Write(line)
 	return err
 }
 
 func (w *Wrapper) child(fn func(slog.Handler) slog.Handler) *Wrapper {
 	return &Wrapper{
-		parent:        w,
-		AddSource:     w.AddSource,
-		Level:         w.Level,
-		ActionsLogger: w.ActionsLogger,
-		handler:       fn(w.handler),
+		parent:              w,
+		AddSource:           w.AddSource,
+		Level:               w.Level,
+		ActionsLogger:       w.ActionsLogger,
+		RecordActionsLogger: w.RecordActionsLogger,
+		annotation:          w.annotation,
+		secrets:             w.secrets,
+		groups:              w.groups,
+		attrs:               w.attrs,
+		handler:             fn(w.handler),
 	}
 }
 
 func (w *Wrapper) WithAttrs(attrs []slog.Attr) slog.Handler {
 	w.init()
-	return w.child(func(h slog.Handler) slog.Handler {
+	annotation, attrs := extractAnnotationAttrs(w.annotation, append([]slog.Attr{}, attrs...))
+	child := w.child(func(h slog.Handler) slog.Handler {
+		if len(attrs) == 0 {
+			return h
+		}
 		return h.WithAttrs(attrs)
 	})
+	child.annotation = annotation
+	child.secrets = appendSecrets(w.secrets[:len(w.secrets):len(w.secrets)], attrs...)
+	if len(attrs) > 0 {
+		grouped := attrs
+		for i := len(w.groups) - 1; i >= 0; i-- {
+			grouped = []slog.Attr{{Key: w.groups[i], Value: slog.GroupValue(grouped...)}}
+		}
+		child.attrs = append(w.attrs[:len(w.attrs):len(w.attrs)], grouped...)
+	}
+	return child
 }
 
 func (w *Wrapper) WithGroup(name string) slog.Handler {
 	w.init()
-	return w.child(func(h slog.Handler) slog.Handler {
+	child := w.child(func(h slog.Handler) slog.Handler {
 		return h.WithGroup(name)
 	})
+	if name != "" {
+		child.groups = append(w.groups[:len(w.groups):len(w.groups)], name)
+	}
+	return child
 }
 
+// colorHandler is implemented by handlers that can write ANSI color codes, like human.Handler.
+type colorHandler interface {
+	ColorEnabled() bool
+}
+
+// escapeWriter appends to buf. It escapes what it writes unless raw is set. Annotations can't display
+// colors, but plain log lines can, so when stripColor is set, ANSI escape sequences are removed from
+// everything but plain log lines.
 type escapeWriter struct {
-	buf *[]byte
+	buf        *[]byte
+	raw        bool
+	stripColor bool
 }
 
 func (e *escapeWriter) Write(p []byte) (int, error) {
-	n := 0
-	for len(p) > 0 {
-		i := bytes.IndexAny(p, "\n\r%")
-		if i < 0 {
-			*e.buf = append(*e.buf, p...)
-			break
+	if e.raw {
+		*e.buf = append(*e.buf, p...)
+		return len(p), nil
+	}
+	n := len(p)
+	if e.stripColor && bytes.IndexByte(p, '\x1b') >= 0 {
+		p = stripANSI(p)
+	}
+	*e.buf = appendEscapedData(*e.buf, p)
+	return n, nil
+}
+
+// stripANSI returns a copy of p without complete ANSI escape sequences. It removes CSI sequences like
+// the ones used for colors and OSC sequences like the ones used for hyperlinks. Any other escape
+// character is left in place.
+func stripANSI(p []byte) []byte {
+	stripped := make([]byte, 0, len(p))
+	for i := 0; i < len(p); i++ {
+		if p[i] == '\x1b' {
+			if n := ansiSequenceLen(p[i:]); n > 0 {
+				i += n - 1
+				continue
+			}
+		}
+		stripped = append(stripped, p[i])
+	}
+	return stripped
+}
+
+// ansiSequenceLen returns the length of the CSI or OSC sequence at the start of p or 0 when p doesn't
+// start with a complete one.
+func ansiSequenceLen(p []byte) int {
+	if len(p) < 2 || p[0] != '\x1b' {
+		return 0
+	}
+	switch p[1] {
+	case '[':
+		i := 2
+		for i < len(p) && p[i] >= 0x20 && p[i] <= 0x3F {
+			i++ // parameter and intermediate bytes
 		}
-		*e.buf = append(*e.buf, p[:i]...)
-		p = p[i:]
-		n += i
-		switch p[0] {
+		if i < len(p) && p[i] >= 0x40 && p[i] <= 0x7E {
+			return i + 1 // final byte
+		}
+	case ']':
+		for i := 2; i < len(p); i++ {
+			switch {
+			case p[i] == '\a':
+				return i + 1
+			case p[i] == '\x1b' && i+1 < len(p) && p[i+1] == '\\':
+				return i + 2
+			}
+		}
+	}
+	return 0
+}
+
+// appendEscapedData appends p to dst escaped the way GitHub expects workflow command data to be escaped.
+func appendEscapedData[T []byte | string](dst []byte, p T) []byte {
+	start := 0
+	for i := 0; i < len(p); i++ {
+		var esc string
+		switch p[i] {
 		case '\n':
-			*e.buf = append(*e.buf, "%0A"...)
+			esc = "%0A"
 		case '\r':
-			*e.buf = append(*e.buf, "%0D"...)
+			esc = "%0D"
 		case '%':
-			*e.buf = append(*e.buf, "%25"...)
+			esc = "%25"
+		default:
+			continue
 		}
-		p = p[1:]
-		n++
+		dst = append(dst, p[start:i]...)
+		dst = append(dst, esc...)
+		start = i + 1
 	}
-	return n, nil
+	return append(dst, p[start:]...)
 }
 
 // DefaultHandler is a slog.TextHandler with time and level output removed because that would
@@ -7,17 +7,21 @@ package actionslog_test
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"golang.org/x/exp/slog"
 	"io"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
 	"testing"
+	"unicode"
 
 	"github.com/stretchr/testify/require"
 	"github.com/willabides/actionslog"
+	"github.com/willabides/actionslog/human"
 )
 
 func ExampleWrapper() {
@@ -63,6 +67,131 @@ func ExampleWrapper_writeDebugToNotice() {
 	// ::notice ::msg="this is an info message"
 }
 
+func ExampleProperties() {
+	logger := slog.New(&actionslog.Wrapper{})
+	logger.Warn(
+		"unused variable",
+		slog.Any("", actionslog.Properties{
+			Title:     "lint",
+			Col:       5,
+			EndLine:   12,
+			EndColumn: 9,
+		}),
+		slog.String("name", "foo"),
+	)
+
+	// Output:
+	//
+	// ::warning col=5,endLine=12,endColumn=9,title=lint::msg="unused variable" name=foo
+}
+
+func ExampleOffsetLocation() {
+	logger := slog.New(&actionslog.Wrapper{})
+	content := []byte("on:\n  push:\n    branchs: [main]\n")
+	start := bytes.Index(content, []byte("branchs"))
+	loc := actionslog.OffsetLocation(".github/workflows/ci.yml", content, start, start+len("branchs"))
+	logger.Error("unknown key", slog.Any("", loc))
+
+	// Output:
+	//
+	// ::error file=.github/workflows/ci.yml,line=3,col=5,endLine=3,endColumn=11::msg="unknown key"
+}
+
+func ExampleGroup() {
+	logger := slog.New(&actionslog.Wrapper{})
+	ctx := context.Background()
+
+	endBuild := actionslog.Group(ctx, logger, "build")
+	logger.Info("building")
+	endImages := actionslog.Group(ctx, logger, "images")
+	logger.Info("building images")
+	endImages()
+	logger.Info("done building")
+	endBuild()
+
+	// Output:
+	//
+	// ::group::build
+	// ::notice ::msg=building
+	// ::endgroup::
+	// ::group::build / images
+	// ::notice ::msg="building images"
+	// ::endgroup::
+	// ::group::build
+	// ::notice ::msg="done building"
+	// ::endgroup::
+}
+
+func ExampleSecret() {
+	logger := slog.New(&actionslog.Wrapper{})
+	logger = logger.With(slog.Any("token", actionslog.Secret("hunter2")))
+	logger.Info("logging in", slog.Group("user", slog.String("name", "bob"), slog.Any("password", actionslog.Secret("p@ssw0rd"))))
+	logger.Info("logging in again", slog.Any("password", actionslog.Secret("p@ssw0rd")))
+
+	// Output:
+	//
+	// ::add-mask::hunter2
+	// ::add-mask::p@ssw0rd
+	// ::notice ::msg="logging in" token=hunter2 user.name=bob user.password=p@ssw0rd
+	// ::notice ::msg="logging in again" token=hunter2 password=p@ssw0rd
+}
+
+func ExampleWrapper_recordActionsLogger() {
+	// Write records with annotate=false as plain log lines and downgrade errors from the retry
+	// package to warnings.
+
+	logger := slog.New(&actionslog.Wrapper{
+		RecordActionsLogger: func(groups []string, attrs []slog.Attr, record slog.Record) (actionslog.ActionsLog, actionslog.Properties) {
+			actionsLog := actionslog.DefaultActionsLog(record.Level)
+			var props actionslog.Properties
+			record.Attrs(func(attr slog.Attr) bool {
+				if attr.Key == "annotate" && attr.Value.Kind() == slog.KindBool && !attr.Value.Bool() {
+					actionsLog = actionslog.LogPlain
+				}
+				return true
+			})
+			for _, attr := range attrs {
+				if attr.Key == "pkg" && attr.Value.String() == "retry" && actionsLog == actionslog.LogError {
+					actionsLog = actionslog.LogWarn
+					props.Title = "retry"
+				}
+			}
+			return actionsLog, props
+		},
+	})
+	logger.Info("not an annotation", slog.Bool("annotate", false))
+	logger.With(slog.String("pkg", "retry")).Error("request failed")
+	logger.Error("request failed")
+
+	// Output:
+	//
+	// msg="not an annotation" annotate=false
+	// ::warning title=retry::msg="request failed" pkg=retry
+	// ::error ::msg="request failed"
+}
+
+func ExampleWrapper_infoToPlain() {
+	// Write info messages as plain log lines so they don't clutter the pull request with notices.
+
+	logger := slog.New(&actionslog.Wrapper{
+		ActionsLogger: func(level slog.Level) actionslog.ActionsLog {
+			if level == slog.LevelInfo {
+				return actionslog.LogPlain
+			}
+			return actionslog.DefaultActionsLog(level)
+		},
+	})
+	logger.Info("this is an info message")
+	logger.Info("untrusted\n::set-output name=foo::bar")
+	logger.Warn("this is a warning")
+
+	// Output:
+	//
+	// msg="this is an info message"
+	// msg="untrusted\n::set-output name=foo::bar"
+	// ::warning ::msg="this is a warning"
+}
+
 func TestWrapper(t *testing.T) {
 	t.Run("concurrency", func(t *testing.T) {
 		var buf bytes.Buffer
@@ -84,7 +213,452 @@ func TestWrapper(t *testing.T) {
 		}
 	})
 
+	t.Run("Group", func(t *testing.T) {
+		t.Run("not a Wrapper", func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+				ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+					if a.Key == slog.TimeKey {
+						return slog.Attr{}
+					}
+					return a
+				},
+			}))
+			end := actionslog.Group(context.Background(), logger, "my group")
+			end()
+			requireEqualString(t, "level=INFO msg=\"my group\"\n", buf.String())
+		})
+
+		t.Run("end out of order", func(t *testing.T) {
+			var buf bytes.Buffer
+			w := &actionslog.Wrapper{Output: &buf}
+			endA := w.Group("a")
+			endB := w.Group("b\nc")
+			endA()
+			endB()
+			endA()
+			requireEqualString(t, `::group::a
+::endgroup::
+::group::a / b%0Ac
+::endgroup::
+`, buf.String())
+		})
+
+		t.Run("concurrency", func(t *testing.T) {
+			var buf bytes.Buffer
+			w := &actionslog.Wrapper{Output: &buf}
+			logger := slog.New(w).With(slog.String("sub", "sub"))
+			end := w.Group("group")
+			var wg sync.WaitGroup
+			for i := 0; i < 100; i++ {
+				wg.Add(1)
+				go func(i int) {
+					logger.Info("hello", slog.Int("i", i))
+					wg.Done()
+				}(i)
+			}
+			wg.Wait()
+			end()
+			lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+			require.Len(t, lines, 102)
+			require.Equal(t, "::group::group", lines[0])
+			require.Equal(t, "::endgroup::", lines[101])
+			for _, line := range lines[1:101] {
+				require.True(t, strings.HasPrefix(line, "::notice ::msg=hello sub=sub i="), line)
+			}
+		})
+	})
+
+	t.Run("Secret", func(t *testing.T) {
+		var buf bytes.Buffer
+		humanHandler := &human.Handler{ExcludeTime: true}
+		logger := slog.New(&actionslog.Wrapper{
+			Output:  &buf,
+			Handler: humanHandler.WithOutput,
+		})
+		a := logger.With(slog.Any("creds", credentials{user: "bob", password: "p@ss%"}))
+		b := logger.WithGroup("b")
+		a.Info("a")
+		b.Info("b", slog.Any("secret", actionslog.Secret(" p@ss% ")))
+		b.Info("b", slog.Any("secret", actionslog.Secret("line1\r\n \nline2\n")))
+		b.Info("b", slog.Any("secret", actionslog.Secret(`a\b "c"`)))
+		b.Info("b", slog.Any("secret", actionslog.Secret("tok\x7fen\x01")))
+		requireEqualString(t, `::add-mask::p@ss%25
+::notice ::a%0A  level: INFO%0A  creds:%0A    user: bob%0A    password: p@ss%25
+::notice ::b%0A  level: INFO%0A  b:%0A    secret: " p@ss%25 "
+::add-mask::line1
+::add-mask::line2
+::notice ::b%0A  level: INFO%0A  b:%0A    secret: "line1\u000d\n \nline2\n"
+::add-mask::a\b "c"
+::add-mask::a\\b \"c\"
+::notice ::b%0A  level: INFO%0A  b:%0A    secret: "a\\b \"c\""
+::add-mask::tok`+"\x7fen\x01"+`
+::add-mask::tok\x7fen\x01
+::add-mask::tok\u007fen\u0001
+::notice ::b%0A  level: INFO%0A  b:%0A    secret: "tok\u007fen\u0001"
+`, buf.String())
+	})
+
+	t.Run("LogPlain", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := slog.New(&actionslog.Wrapper{
+			Output: &buf,
+			ActionsLogger: func(slog.Level) actionslog.ActionsLog {
+				return actionslog.LogPlain
+			},
+			Handler: func(w io.Writer) slog.Handler {
+				return &rawMsgHandler{w: w}
+			},
+		})
+		logger.Info("50%\r\n ::add-mask::foo\n\t::error::oops\r::\n##[group]x\n")
+		requireEqualString(t, "50%\r\n"+
+			"\u200b ::add-mask::foo\n"+
+			"\u200b\t::error::oops\r"+
+			"\u200b::\n"+
+			"##\u200b[group]x\n", buf.String())
+	})
+
+	t.Run("ANSI colors", func(t *testing.T) {
+		t.Setenv("RUNNER_DEBUG", "")
+		var buf bytes.Buffer
+		humanHandler := &human.Handler{
+			ExcludeTime:  true,
+			ExcludeLevel: true,
+			Level:        slog.LevelDebug,
+			Color:        human.ColorOn,
+		}
+		logger := slog.New(&actionslog.Wrapper{
+			Output:        &buf,
+			Handler:       humanHandler.WithOutput,
+			ActionsLogger: actionslog.RunnerDebugActionsLog,
+		})
+		logger.Warn("hello", slog.String("a", "b"))
+		logger.Info("link \x1b]8;;https://example.com\x1b\\here\x1b]8;;\a \x1b[1;2mbold\x1b[22m")
+		logger.Info("not sequences \x1bA \x1b[1;2")
+		logger.Debug("debug", slog.String("a", "b"))
+		requireEqualString(t, "::warning ::hello%0A  a: b\n"+
+			"::notice ::link here bold\n"+
+			"::notice ::not sequences \x1bA \x1b[1;2\n"+
+			"\x1b[34mdebug\x1b[0m\n  \x1b[36ma\x1b[0m: b\n", buf.String())
+	})
+
+	t.Run("StopCommands", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := slog.New(&actionslog.Wrapper{
+			Output:       &buf,
+			StopCommands: true,
+			ActionsLogger: func(level slog.Level) actionslog.ActionsLog {
+				if level == slog.LevelInfo {
+					return actionslog.LogPlain
+				}
+				return actionslog.DefaultActionsLog(level)
+			},
+			Handler: func(w io.Writer) slog.Handler {
+				return &rawMsgHandler{w: w}
+			},
+		})
+		logger.Info("line 1\n  ::add-mask::foo\n")
+		logger.Warn("warning")
+		logger.Info("line 2")
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		require.Len(t, lines, 8)
+		token := strings.TrimPrefix(lines[0], "::stop-commands::")
+		require.Len(t, token, 32)
+		requireEqualString(t, "::stop-commands::"+token+`
+line 1
+  ::add-mask::foo
+::`+token+`::
+::warning ::warning
+::stop-commands::`+token+`
+line 2
+::`+token+`::
+`, buf.String())
+	})
+
+	t.Run("command injection", func(t *testing.T) {
+		for _, stopCommands := range []bool{false, true} {
+			t.Run(fmt.Sprintf("StopCommands=%v", stopCommands), func(t *testing.T) {
+				var buf bytes.Buffer
+				w := &actionslog.Wrapper{
+					Output:       &buf,
+					Level:        slog.LevelDebug,
+					StopCommands: stopCommands,
+					ActionsLogger: func(level slog.Level) actionslog.ActionsLog {
+						if level == slog.LevelInfo {
+							return actionslog.LogPlain
+						}
+						return actionslog.DefaultActionsLog(level)
+					},
+					Handler: func(w io.Writer) slog.Handler {
+						return &rawMsgHandler{w: w}
+					},
+				}
+				logger := slog.New(w)
+				// Learn the token the way an attacker reading the log could.
+				logger.Info("hello")
+				_, token, _ := strings.Cut(strings.SplitN(buf.String(), "\n", 2)[0], "::stop-commands::")
+				crafted := []string{
+					"::set-output name=foo::bar",
+					"x\n::add-mask::foo",
+					"x\r::add-mask::foo",
+					"x\n \t::set-output name=foo::bar",
+					"x\n::" + token + "::\n::set-output name=foo::bar",
+					"x\n  ::" + token + "::\n::add-mask::foo",
+					"x\n::endgroup::\n::stop-commands::abc\n::set-output name=foo::bar",
+					"x\n%0A::add-mask::foo",
+					"x ##[add-mask]foo",
+					"x\n  k: \"a ##[set-output name=x;]y\"",
+					"x\n###[add-mask]foo ##[##[add-mask]bar",
+				}
+				for _, msg := range crafted {
+					for _, level := range []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError} {
+						logger.Log(context.Background(), level, msg)
+					}
+				}
+				for _, cmd := range runnerCommands(buf.String()) {
+					require.Contains(t, []string{"debug", "warning", "error"}, cmd.name)
+				}
+			})
+		}
+	})
+
+	t.Run("Mode", func(t *testing.T) {
+		for _, td := range []struct {
+			mode          actionslog.Mode
+			githubActions string
+			local         bool
+		}{
+			{mode: actionslog.ModeActions, githubActions: "", local: false},
+			{mode: actionslog.ModeLocal, githubActions: "true", local: true},
+			{mode: actionslog.ModeAuto, githubActions: "true", local: false},
+			{mode: actionslog.ModeAuto, githubActions: "", local: true},
+			{mode: actionslog.ModeAuto, githubActions: "false", local: true},
+		} {
+			t.Run(fmt.Sprintf("%d %q", td.mode, td.githubActions), func(t *testing.T) {
+				t.Setenv("GITHUB_ACTIONS", td.githubActions)
+				t.Setenv("GITHUB_OUTPUT", "")
+				var buf, localBuf bytes.Buffer
+				w := &actionslog.Wrapper{
+					Output:      &buf,
+					LocalOutput: &localBuf,
+					Mode:        td.mode,
+					AddSource:   true,
+				}
+				logger := slog.New(w).With(slog.Any("props", actionslog.Properties{Title: "title"}))
+				end := w.Group("group")
+				logger.Info("hello\nworld", slog.String("foo", "bar"))
+				end()
+				require.NoError(t, w.SetOutput("foo", "bar"))
+				if !td.local {
+					require.Empty(t, localBuf.String())
+					requireStringContains(t, `::notice `, buf.String())
+					return
+				}
+				require.Empty(t, buf.String())
+				requireEqualString(t, "msg=\"hello\\nworld\" foo=bar\n", localBuf.String())
+			})
+		}
+	})
+
+	t.Run("RunnerLevel", func(t *testing.T) {
+		for _, runnerDebug := range []string{"", "1"} {
+			t.Run(fmt.Sprintf("RUNNER_DEBUG=%q", runnerDebug), func(t *testing.T) {
+				t.Setenv("RUNNER_DEBUG", runnerDebug)
+				var buf bytes.Buffer
+				humanHandler := &human.Handler{
+					ExcludeTime:  true,
+					ExcludeLevel: true,
+					Level:        actionslog.RunnerLevel{},
+				}
+				logger := slog.New(&actionslog.Wrapper{
+					Output:  &buf,
+					Handler: humanHandler.WithOutput,
+				})
+				logger.Debug("debug")
+				logger.Info("info")
+				want := "::notice ::info\n"
+				if runnerDebug == "1" {
+					want = "::debug ::debug\n" + want
+				}
+				requireEqualString(t, want, buf.String())
+			})
+		}
+	})
+
+	t.Run("RunnerDebugActionsLog", func(t *testing.T) {
+		for _, runnerDebug := range []string{"", "1"} {
+			t.Run(fmt.Sprintf("RUNNER_DEBUG=%q", runnerDebug), func(t *testing.T) {
+				t.Setenv("RUNNER_DEBUG", runnerDebug)
+				var buf bytes.Buffer
+				logger := slog.New(&actionslog.Wrapper{
+					Output:        &buf,
+					Level:         actionslog.RunnerLevel{Default: slog.LevelDebug},
+					ActionsLogger: actionslog.RunnerDebugActionsLog,
+				})
+				logger.Debug("debug")
+				logger.Info("info")
+				want := "msg=debug\n::notice ::msg=info\n"
+				if runnerDebug == "1" {
+					want = "::debug ::msg=debug\n::notice ::msg=info\n"
+				}
+				requireEqualString(t, want, buf.String())
+			})
+		}
+	})
+
+	t.Run("RecordActionsLogger", func(t *testing.T) {
+		var buf bytes.Buffer
+		var gotGroups []string
+		var gotAttrs []slog.Attr
+		logger := slog.New(&actionslog.Wrapper{
+			Output: &buf,
+			ActionsLogger: func(slog.Level) actionslog.ActionsLog {
+				return actionslog.LogDebug
+			},
+			RecordActionsLogger: func(groups []string, attrs []slog.Attr, record slog.Record) (actionslog.ActionsLog, actionslog.Properties) {
+				gotGroups = groups
+				gotAttrs = attrs
+				require.Equal(t, 1, record.NumAttrs())
+				return actionslog.LogWarn, actionslog.Properties{Title: "from hook"}
+			},
+		})
+		logger = logger.With(slog.String("a", "b"), slog.Any("", actionslog.Properties{Title: "from attrs", Col: 3}))
+		logger = logger.WithGroup("g1").With(slog.String("c", "d"))
+		logger = logger.WithGroup("g2").WithGroup("g3").With(slog.String("e", "f"))
+		logger.Info("hello", slog.String("g", "h"), slog.Any("", actionslog.Properties{Col: 4}))
+		requireEqualString(t, "::warning col=4,title=from hook::msg=hello a=b g1.c=d g1.g2.g3.e=f g1.g2.g3.g=h\n", buf.String())
+		require.Equal(t, []string{"g1", "g2", "g3"}, gotGroups)
+		require.Equal(t, []slog.Attr{
+			slog.String("a", "b"),
+			slog.Group("g1", slog.String("c", "d")),
+			slog.Group("g1", slog.Group("g2", slog.Group("g3", slog.String("e", "f")))),
+		}, gotAttrs)
+	})
+
+	t.Run("AnnotationLimit", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := &actionslog.Wrapper{
+			Output:          &buf,
+			Level:           slog.LevelDebug,
+			AnnotationLimit: 2,
+			Handler: func(w io.Writer) slog.Handler {
+				return &rawMsgHandler{w: w}
+			},
+		}
+		logger := slog.New(w)
+		sub := logger.With(slog.String("sub", "sub"))
+		require.NoError(t, w.ReportSuppressed())
+		for i := 0; i < 3; i++ {
+			logger.Debug("debug " + strconv.Itoa(i))
+			logger.Warn("warn " + strconv.Itoa(i))
+			sub.Error("error " + strconv.Itoa(i))
+		}
+		sub.Error("multiline\n::set-output name=foo::bar\n  ##[error]oops\n")
+		require.NoError(t, w.ReportSuppressed())
+		requireEqualString(t, `::debug ::debug 0
+::warning ::warn 0
+::error ::error 0
+::debug ::debug 1
+::warning ::warn 1
+::error ::error 1
+::debug ::debug 2
+warn 2
+error 2
+multiline
+`+"\u200b"+`::set-output name=foo::bar
+  ##`+"\u200b"+`[error]oops
+Reached the limit of 2 annotations of each kind. Wrote 2 error, 1 warning records as plain log lines instead.
+`, buf.String())
+	})
+
+	t.Run("Stats", func(t *testing.T) {
+		w := &actionslog.Wrapper{
+			Output:          io.Discard,
+			Level:           slog.LevelDebug,
+			AnnotationLimit: 1,
+		}
+		logger := slog.New(w)
+		require.Equal(t, map[actionslog.ActionsLog]int{}, w.Stats())
+		require.False(t, w.Failed())
+		require.Equal(t, 0, actionslog.ExitCode(w))
+		logger.Debug("debug")
+		logger.With(slog.String("a", "b")).Warn("warn")
+		logger.WithGroup("g").Warn("warn")
+		require.False(t, w.Failed())
+		logger.Error("error")
+		require.Equal(t, map[actionslog.ActionsLog]int{
+			actionslog.LogDebug: 1,
+			actionslog.LogWarn:  2,
+			actionslog.LogError: 1,
+		}, w.Stats())
+		require.True(t, w.Failed())
+		require.Equal(t, 1, actionslog.ExitCode(logger.Handler()))
+		require.Equal(t, 0, actionslog.ExitCode(slog.NewTextHandler(io.Discard, nil)))
+
+		w = &actionslog.Wrapper{
+			Mode:          actionslog.ModeLocal,
+			LocalOutput:   io.Discard,
+			FailOnWarning: true,
+		}
+		logger = slog.New(w)
+		logger.Info("info")
+		require.False(t, w.Failed())
+		logger.With(slog.String("a", "b")).Warn("warn")
+		require.Equal(t, map[actionslog.ActionsLog]int{
+			actionslog.LogNotice: 1,
+			actionslog.LogWarn:   1,
+		}, w.Stats())
+		require.True(t, w.Failed())
+	})
+
+	t.Run("RecoverAndReport", func(t *testing.T) {
+		_, thisFile, _, _ := runtime.Caller(0)
+		var buf bytes.Buffer
+		logger := slog.New(&actionslog.Wrapper{
+			Output:    &buf,
+			Workspace: filepath.Dir(thisFile),
+		})
+		var panicLine int
+		func() {
+			defer func() {
+				require.Equal(t, "boom", recover())
+			}()
+			defer actionslog.RecoverAndReport(logger)
+			_, _, panicLine, _ = runtime.Caller(0)
+			panic("boom")
+		}()
+		panicLine++
+		var nilMap map[string]int
+		var nilMapLine int
+		func() {
+			defer func() {
+				require.NotNil(t, recover())
+			}()
+			defer actionslog.RecoverAndReport(logger)
+			_, _, nilMapLine, _ = runtime.Caller(0)
+			nilMap["a"] = 1
+		}()
+		nilMapLine++
+		lines := strings.Split(buf.String(), "\n")
+		require.Equal(t, "::error file="+filepath.Base(thisFile)+",line="+strconv.Itoa(panicLine)+"::msg=\"panic: boom\"", lines[0])
+		require.Equal(t, "::group::Stack trace", lines[1])
+		require.True(t, strings.HasPrefix(lines[2], "goroutine "))
+		require.Contains(t, buf.String(), "::endgroup::\n::error file="+filepath.Base(thisFile)+",line="+strconv.Itoa(nilMapLine)+"::")
+
+		buf.Reset()
+		logger = slog.New(slog.NewTextHandler(&buf, nil))
+		func() {
+			defer func() {
+				require.Equal(t, "boom", recover())
+			}()
+			defer actionslog.RecoverAndReport(logger)
+			panic("boom")
+		}()
+		requireStringContains(t, `msg="panic: boom" stack="goroutine `, buf.String())
+	})
+
 	t.Run("AddSource", func(t *testing.T) {
+		t.Setenv("GITHUB_WORKSPACE", "")
 		var buf bytes.Buffer
 		logger := slog.New(&actionslog.Wrapper{
 			Output:    &buf,
@@ -97,6 +671,212 @@ func TestWrapper(t *testing.T) {
 		requireEqualString(t, want, buf.String())
 	})
 
+	t.Run("Helper", func(t *testing.T) {
+		t.Setenv("GITHUB_WORKSPACE", "")
+		var buf bytes.Buffer
+		logger := slog.New(&actionslog.Wrapper{
+			Output:    &buf,
+			AddSource: true,
+		})
+		_, wantFile, wantLine, _ := runtime.Caller(0)
+		reportFailure(logger, "failed")
+		wantLine++
+		want := "::error file=" + wantFile + ",line=" + strconv.Itoa(wantLine) + "::msg=failed\n"
+		requireEqualString(t, want, buf.String())
+
+		buf.Reset()
+		logger = slog.New(&human.Handler{
+			Output:      &buf,
+			AddSource:   true,
+			ExcludeTime: true,
+		})
+		_, _, wantLine, _ = runtime.Caller(0)
+		reportFailure(logger, "failed")
+		wantLine++
+		requireStringContains(t, "line: "+strconv.Itoa(wantLine)+"\n", buf.String())
+	})
+
+	t.Run("Workspace", func(t *testing.T) {
+		_, thisFile, _, _ := runtime.Caller(0)
+		thisDir := filepath.Dir(thisFile)
+
+		t.Run("GITHUB_WORKSPACE", func(t *testing.T) {
+			t.Setenv("GITHUB_WORKSPACE", filepath.Dir(thisDir))
+			var buf bytes.Buffer
+			logger := slog.New(&actionslog.Wrapper{
+				Output:    &buf,
+				AddSource: true,
+			})
+			_, _, wantLine, _ := runtime.Caller(0)
+			logger.Info("hello")
+			wantLine++
+			want := "::notice file=" + filepath.Base(thisDir) + "/" + filepath.Base(thisFile) + ",line=" + strconv.Itoa(wantLine) + "::msg=hello\n"
+			requireEqualString(t, want, buf.String())
+		})
+
+		t.Run("Workspace field", func(t *testing.T) {
+			t.Setenv("GITHUB_WORKSPACE", "/does/not/exist")
+			var buf bytes.Buffer
+			logger := slog.New(&actionslog.Wrapper{
+				Output:    &buf,
+				AddSource: true,
+				Workspace: thisDir,
+			})
+			_, _, wantLine, _ := runtime.Caller(0)
+			logger.Info("hello")
+			wantLine++
+			want := "::notice file=" + filepath.Base(thisFile) + ",line=" + strconv.Itoa(wantLine) + "::msg=hello\n"
+			requireEqualString(t, want, buf.String())
+		})
+
+		t.Run("PathRewrites", func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(&actionslog.Wrapper{
+				Output:    &buf,
+				AddSource: true,
+				Workspace: filepath.Join(thisDir, "internal"),
+				PathRewrites: []actionslog.PathRewrite{
+					{Prefix: filepath.ToSlash(thisDir) + "x"},
+					{Prefix: filepath.ToSlash(thisDir), Replacement: "pkg"},
+				},
+			})
+			_, _, wantLine, _ := runtime.Caller(0)
+			logger.Info("hello")
+			wantLine++
+			want := "::notice file=pkg/" + filepath.Base(thisFile) + ",line=" + strconv.Itoa(wantLine) + "::msg=hello\n"
+			requireEqualString(t, want, buf.String())
+		})
+
+		t.Run("PathRewrites empty Replacement", func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(&actionslog.Wrapper{
+				Output:       &buf,
+				AddSource:    true,
+				Workspace:    filepath.Join(thisDir, "internal"),
+				PathRewrites: []actionslog.PathRewrite{{Prefix: filepath.ToSlash(thisDir)}},
+			})
+			_, _, wantLine, _ := runtime.Caller(0)
+			logger.Info("hello")
+			wantLine++
+			want := "::notice file=" + filepath.Base(thisFile) + ",line=" + strconv.Itoa(wantLine) + "::msg=hello\n"
+			requireEqualString(t, want, buf.String())
+		})
+
+		t.Run("error stack", func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(&actionslog.Wrapper{
+				Output:    &buf,
+				AddSource: true,
+				Workspace: thisDir,
+			})
+			_, _, errLine, _ := runtime.Caller(0)
+			err := actionslog.WithCaller(errors.New("boom"))
+			errLine++
+			wrapped := fmt.Errorf("wrapped: %w", errors.Join(errors.New("no stack"), err))
+			logger.Error("failed", slog.String("foo", "bar"), slog.Any("err", wrapped))
+			_, _, logLine, _ := runtime.Caller(0)
+			logger.Error("failed", slog.Any("err", errors.New("no stack")))
+			logLine++
+			stackErr := stackError{stack: []uintptr{0}}
+			runtime.Callers(1, stackErr.stack)
+			logger.Error("failed", slog.Any("err", stackErr))
+			requireEqualString(t, "::error file="+filepath.Base(thisFile)+",line="+strconv.Itoa(errLine)+"::"+
+				`msg=failed foo=bar err="wrapped: no stack\nboom"`+"\n"+
+				"::error file="+filepath.Base(thisFile)+",line="+strconv.Itoa(logLine)+"::msg=failed err=\"no stack\"\n"+
+				"::error file="+filepath.Base(thisFile)+",line="+strconv.Itoa(logLine+3)+"::msg=failed err=\"stack error\"\n",
+				buf.String())
+		})
+
+		t.Run("outside workspace", func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(&actionslog.Wrapper{
+				Output:    &buf,
+				AddSource: true,
+				Workspace: filepath.Join(thisDir, "internal"),
+			})
+			logger.Info("hello")
+			requireEqualString(t, "::notice ::msg=hello\n", buf.String())
+		})
+	})
+
+	t.Run("Properties", func(t *testing.T) {
+		t.Setenv("GITHUB_WORKSPACE", "")
+		var buf bytes.Buffer
+		logger := slog.New(&actionslog.Wrapper{
+			Output:    &buf,
+			AddSource: true,
+		})
+		logger = logger.With(
+			slog.Any("props", actionslog.Properties{Title: "parent title", Col: 2}),
+			slog.String("a", "b"),
+		)
+		_, wantFile, wantLine, _ := runtime.Caller(0)
+		logger.Info("hello", slog.Any("props", actionslog.Properties{Title: "my title", EndLine: 20}))
+		wantLine++
+		want := "::notice file=" + wantFile + ",line=" + strconv.Itoa(wantLine) + ",col=2,endLine=20,title=my title::msg=hello a=b\n"
+		requireEqualString(t, want, buf.String())
+	})
+
+	t.Run("Location", func(t *testing.T) {
+		_, thisFile, _, _ := runtime.Caller(0)
+		thisDir := filepath.Dir(thisFile)
+
+		var buf bytes.Buffer
+		logger := slog.New(&actionslog.Wrapper{
+			Output:    &buf,
+			Workspace: thisDir,
+		})
+		logger.With(
+			slog.Any("", actionslog.Location{File: "db/001.sql", Line: 3, Col: 1, EndLine: 4}),
+		).Warn("slow query",
+			slog.Any("", actionslog.Properties{Col: 7}),
+			slog.String("table", "users"),
+		)
+		logger.Error("bad config", slog.Any("loc", actionslog.Location{
+			File: filepath.Join(thisDir, "config", "app.yml"),
+			Line: 12,
+		}))
+		logger.Error("outside workspace", slog.Any("loc", actionslog.Location{
+			File: filepath.Join(filepath.Dir(thisDir), "app.yml"),
+			Line: 12,
+			Col:  2,
+		}))
+		requireEqualString(t, `::warning file=db/001.sql,line=3,col=7,endLine=4::msg="slow query" table=users
+::error file=config/app.yml,line=12::msg="bad config"
+::error col=2::msg="outside workspace"
+`, buf.String())
+
+		buf.Reset()
+		logger = slog.New(&actionslog.Wrapper{
+			Mode:        actionslog.ModeLocal,
+			LocalOutput: &buf,
+			Handler: func(w io.Writer) slog.Handler {
+				return slog.NewTextHandler(w, &slog.HandlerOptions{
+					ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+						if a.Key == slog.TimeKey {
+							return slog.Attr{}
+						}
+						return a
+					},
+				})
+			},
+		})
+		logger.Info("hello", slog.Any("", actionslog.Location{File: "a.yml", Line: 1}))
+		requireEqualString(t, "level=INFO msg=hello\n", buf.String())
+	})
+
+	t.Run("OffsetLocation", func(t *testing.T) {
+		content := []byte("héllo\nwörld\n")
+		require.Equal(t, actionslog.Location{File: "f", Line: 1, Col: 1, EndLine: 2, EndColumn: 4},
+			actionslog.OffsetLocation("f", content, 0, bytes.Index(content, []byte("d"))))
+		require.Equal(t, actionslog.Location{File: "f", Line: 2, Col: 2, EndLine: 2, EndColumn: 2},
+			actionslog.OffsetLocation("f", content, bytes.Index(content, []byte("ö")), bytes.Index(content, []byte("r"))))
+		require.Equal(t, actionslog.Location{File: "f", Line: 3, Col: 1},
+			actionslog.OffsetLocation("f", content, 100, 200))
+		require.Equal(t, actionslog.Location{File: "f", Line: 1, Col: 1},
+			actionslog.OffsetLocation("f", content, -1, 0))
+	})
+
 	t.Run("WithGroup", func(t *testing.T) {
 		var buf bytes.Buffer
 		logger := slog.New(&actionslog.Wrapper{Output: &buf})
@@ -218,6 +998,188 @@ func TestWrapper(t *testing.T) {
 	})
 }
 
+func FuzzWrapper(f *testing.F) {
+	f.Add("title", "message")
+	f.Add("a:b,c%d", "50% done")
+	f.Add("line1\r\nline2::", "::error::oops\n%0A")
+	f.Add(" spaces ", "%25%0D%3A%2C")
+	f.Add("\x1b[31mred\x1b[0m", "\x1b")
+	f.Add("\x1b]8;;x\a", "\x1bA\x1b[1m")
+	f.Fuzz(func(t *testing.T, title, msg string) {
+		var buf bytes.Buffer
+		logger := slog.New(&actionslog.Wrapper{
+			Output: &buf,
+			Handler: func(w io.Writer) slog.Handler {
+				return &rawMsgHandler{w: w}
+			},
+		})
+		file := filepath.Join("dir", title)
+		logger.Warn(msg,
+			slog.Any("", actionslog.Properties{Title: title}),
+			slog.Any("", actionslog.Location{File: file, Line: 1}),
+		)
+		out := buf.String()
+		require.Equal(t, 1, strings.Count(out, "\n"))
+		cmd, ok := parseCommand(strings.TrimSuffix(out, "\n"))
+		require.True(t, ok)
+		require.Equal(t, "warning", cmd.name)
+		require.Equal(t, strings.TrimRight(msg, "\r\n"), cmd.data)
+		require.Equal(t, filepath.ToSlash(file), cmd.properties["file"])
+		wantTitle := strings.TrimSpace(title)
+		if wantTitle == "" {
+			require.NotContains(t, cmd.properties, "title")
+			return
+		}
+		require.Equal(t, wantTitle, cmd.properties["title"])
+	})
+}
+
+// command is a workflow command as parsed by the GitHub Actions runner.
+type command struct {
+	name       string
+	properties map[string]string
+	data       string
+}
+
+// parseCommand parses a line the way the GitHub Actions runner does. See ActionCommand.TryParseV2
+// in https://github.com/actions/runner/blob/main/src/Runner.Worker/ActionCommandManager.cs
+func parseCommand(line string) (command, bool) {
+	line = strings.TrimLeftFunc(line, unicode.IsSpace)
+	if !strings.HasPrefix(line, "::") {
+		return command{}, false
+	}
+	end := strings.Index(line[2:], "::")
+	if end < 0 {
+		return command{}, false
+	}
+	info := line[2 : end+2]
+	cmd := command{
+		name:       info,
+		properties: map[string]string{},
+		data:       unescapeData(line[end+4:]),
+	}
+	name, props, ok := strings.Cut(info, " ")
+	if !ok {
+		return cmd, true
+	}
+	cmd.name = name
+	for _, prop := range strings.Split(strings.TrimSpace(props), ",") {
+		k, v, _ := strings.Cut(prop, "=")
+		if k == "" || v == "" {
+			continue
+		}
+		cmd.properties[k] = unescapeProperty(v)
+	}
+	return cmd, true
+}
+
+// parseLegacyCommand parses a line the way the GitHub Actions runner parses "##[name key=value;]data"
+// commands when the line isn't a "::" command. See ActionCommand.TryParse in
+// https://github.com/actions/runner/blob/main/src/Runner.Worker/ActionCommandManager.cs
+func parseLegacyCommand(line string) (command, bool) {
+	start := strings.Index(line, "##[")
+	if start < 0 {
+		return command{}, false
+	}
+	info, data, ok := strings.Cut(line[start+3:], "]")
+	if !ok {
+		return command{}, false
+	}
+	name, props, _ := strings.Cut(info, " ")
+	cmd := command{
+		name:       name,
+		properties: map[string]string{},
+		data:       data,
+	}
+	for _, prop := range strings.Split(props, ";") {
+		k, v, _ := strings.Cut(prop, "=")
+		if k == "" || v == "" {
+			continue
+		}
+		cmd.properties[k] = v
+	}
+	return cmd, true
+}
+
+// runnerCommands returns the commands the GitHub Actions runner would process from output.
+// stop-commands and the matching resume command are handled but not returned.
+func runnerCommands(output string) []command {
+	var commands []command
+	stopToken := ""
+	// The runner splits lines on "\r" as well as "\n".
+	output = strings.ReplaceAll(output, "\r\n", "\n")
+	for _, line := range strings.FieldsFunc(output, func(r rune) bool { return r == '\r' || r == '\n' }) {
+		cmd, ok := parseCommand(line)
+		if !ok && stopToken == "" {
+			cmd, ok = parseLegacyCommand(line)
+		}
+		if !ok {
+			continue
+		}
+		if stopToken != "" {
+			if cmd.name == stopToken {
+				stopToken = ""
+			}
+			continue
+		}
+		if cmd.name == "stop-commands" {
+			stopToken = cmd.data
+			continue
+		}
+		commands = append(commands, cmd)
+	}
+	return commands
+}
+
+func unescapeData(s string) string {
+	s = strings.ReplaceAll(s, "%0D", "\r")
+	s = strings.ReplaceAll(s, "%0A", "\n")
+	return strings.ReplaceAll(s, "%25", "%")
+}
+
+func unescapeProperty(s string) string {
+	s = strings.ReplaceAll(s, "%0D", "\r")
+	s = strings.ReplaceAll(s, "%0A", "\n")
+	s = strings.ReplaceAll(s, "%3A", ":")
+	s = strings.ReplaceAll(s, "%2C", ",")
+	return strings.ReplaceAll(s, "%25", "%")
+}
+
+// reportFailure and logFailure are logging helpers for testing actionslog.Helper.
+func reportFailure(logger *slog.Logger, msg string) {
+	actionslog.Helper()
+	logFailure(logger, msg)
+}
+
+func logFailure(logger *slog.Logger, msg string) {
+	actionslog.Helper()
+	logger.Error(msg)
+}
+
+type stackError struct {
+	stack []uintptr
+}
+
+func (e stackError) Error() string {
+	return "stack error"
+}
+
+func (e stackError) StackTrace() []uintptr {
+	return e.stack
+}
+
+type credentials struct {
+	user     string
+	password string
+}
+
+func (c credentials) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("user", c.user),
+		slog.Any("password", actionslog.Secret(c.password)),
+	)
+}
+
 func requireEqualString(t *testing.T, want, got string) {
 	t.Helper()
 	if want != got {
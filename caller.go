@@ -0,0 +1,84 @@
+//go:build go1.21
+
+package actionslog
+
+import (
+	"log/slog"
+	"runtime"
+)
+
+// WithCaller returns an error that wraps err and records where WithCaller was called. When a Wrapper with
+// AddSource set logs a record with the returned error as an attribute, the annotation points to that
+// location instead of the log statement. WithCaller returns nil if err is nil.
+//
+// The Wrapper will use the stack of any error with a StackTrace() []uintptr method the same way. The
+// returned slice is expected to be in the form returned by runtime.Callers.
+func WithCaller(err error) error {
+	if err == nil {
+		return nil
+	}
+	var pcs [1]uintptr
+	runtime.Callers(2, pcs[:])
+	return &callerError{err: err, pc: pcs[0]}
+}
+
+type callerError struct {
+	err error
+	pc  uintptr
+}
+
+func (e *callerError) Error() string {
+	return e.err.Error()
+}
+
+func (e *callerError) Unwrap() error {
+	return e.err
+}
+
+func (e *callerError) StackTrace() []uintptr {
+	return []uintptr{e.pc}
+}
+
+type stackTracer interface {
+	StackTrace() []uintptr
+}
+
+// errorStack returns the stack of the innermost error in err's tree that has one. Errors that wrap more
+// than one error are searched in order.
+func errorStack(err error) []uintptr {
+	var inner []uintptr
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		inner = errorStack(e.Unwrap())
+	case interface{ Unwrap() []error }:
+		for _, ee := range e.Unwrap() {
+			inner = errorStack(ee)
+			if len(inner) > 0 {
+				break
+			}
+		}
+	}
+	if len(inner) > 0 {
+		return inner
+	}
+	if st, ok := err.(stackTracer); ok {
+		return st.StackTrace()
+	}
+	return nil
+}
+
+// recordErrorStack returns the stack of the first error attribute in record that has one.
+func recordErrorStack(record slog.Record) []uintptr {
+	var stack []uintptr
+	record.Attrs(func(attr slog.Attr) bool {
+		if attr.Value.Kind() != slog.KindAny {
+			return true
+		}
+		err, ok := attr.Value.Any().(error)
+		if ok {
+			stack = errorStack(err)
+		}
+		return len(stack) == 0
+	})
+	return stack
+}
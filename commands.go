@@ -0,0 +1,117 @@
+//go:build go1.21
+
+package actionslog
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// SetOutput sets the step output name to value. It appends to the file named by GITHUB_OUTPUT. When
+// GITHUB_OUTPUT isn't set, it writes a ::set-output command to the Wrapper's Output instead.
+//
+// SetOutput, ExportVariable, AddPath and SaveState don't write legacy commands when the Wrapper's Mode
+// resolves to ModeLocal.
+func (w *Wrapper) SetOutput(name, value string) error {
+	return w.keyValueCommand("GITHUB_OUTPUT", "set-output", name, value)
+}
+
+// ExportVariable sets the environment variable name to value for this process and for later steps in
+// the job. It appends to the file named by GITHUB_ENV. When GITHUB_ENV isn't set, it writes a ::set-env
+// command to the Wrapper's Output instead.
+func (w *Wrapper) ExportVariable(name, value string) error {
+	err := os.Setenv(name, value)
+	if err != nil {
+		return err
+	}
+	return w.keyValueCommand("GITHUB_ENV", "set-env", name, value)
+}
+
+// AddPath prepends dir to PATH for this process and for later steps in the job. It appends to the file
+// named by GITHUB_PATH. When GITHUB_PATH isn't set, it writes an ::add-path command to the Wrapper's
+// Output instead.
+func (w *Wrapper) AddPath(dir string) error {
+	err := os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	if err != nil {
+		return err
+	}
+	w.init()
+	root := w.root()
+	root.mux.Lock()
+	defer root.mux.Unlock()
+	filename := os.Getenv("GITHUB_PATH")
+	if filename == "" {
+		if root.local {
+			return nil
+		}
+		return root.writeCommand("add-path", dir)
+	}
+	return appendToFile(filename, dir+"\n")
+}
+
+// SaveState saves value as state name for the action's post step. It appends to the file named by
+// GITHUB_STATE. When GITHUB_STATE isn't set, it writes a ::save-state command to the Wrapper's Output
+// instead.
+func (w *Wrapper) SaveState(name, value string) error {
+	return w.keyValueCommand("GITHUB_STATE", "save-state", name, value)
+}
+
+// keyValueCommand writes name and value to the file named by the environment variable envVar or
+// falls back to the legacy workflow command.
+func (w *Wrapper) keyValueCommand(envVar, legacyCommand, name, value string) error {
+	w.init()
+	root := w.root()
+	root.mux.Lock()
+	defer root.mux.Unlock()
+	filename := os.Getenv(envVar)
+	if filename == "" {
+		if root.local {
+			return nil
+		}
+		return root.writeCommand(legacyCommand, value, "name", name)
+	}
+	delimiter, err := heredocDelimiter()
+	if err != nil {
+		return err
+	}
+	if strings.Contains(name, delimiter) || strings.Contains(value, delimiter) {
+		return fmt.Errorf("name or value contains the delimiter %q", delimiter)
+	}
+	return appendToFile(filename, name+"<<"+delimiter+"\n"+value+"\n"+delimiter+"\n")
+}
+
+// heredocDelimiter returns a random delimiter in the same form that @actions/core uses.
+func heredocDelimiter() (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	return "ghadelimiter_" + token, nil
+}
+
+// randomToken returns 32 random hex characters.
+func randomToken() (string, error) {
+	var b [16]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+func appendToFile(filename, content string) error {
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, content)
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
@@ -0,0 +1,99 @@
+//go:build go1.21
+
+package actionslog_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/actionslog"
+)
+
+func TestWrapper_commands(t *testing.T) {
+	t.Run("files", func(t *testing.T) {
+		dir := t.TempDir()
+		for _, envVar := range []string{"GITHUB_OUTPUT", "GITHUB_ENV", "GITHUB_PATH", "GITHUB_STATE"} {
+			t.Setenv(envVar, filepath.Join(dir, envVar))
+		}
+		t.Setenv("ACTIONSLOG_TEST_VAR", "")
+		t.Setenv("PATH", "/usr/bin")
+		var buf bytes.Buffer
+		w := &actionslog.Wrapper{Output: &buf}
+		require.NoError(t, w.SetOutput("single", "value"))
+		require.NoError(t, w.SetOutput("multi", "line 1\nline 2\n"))
+		require.NoError(t, w.ExportVariable("ACTIONSLOG_TEST_VAR", "foo"))
+		require.NoError(t, w.AddPath("/my/bin"))
+		require.NoError(t, w.SaveState("state", "a\r\nb"))
+		require.Empty(t, buf.String())
+
+		require.Equal(t, map[string]string{
+			"single": "value",
+			"multi":  "line 1\nline 2\n",
+		}, readKeyValueFile(t, filepath.Join(dir, "GITHUB_OUTPUT")))
+		require.Equal(t, map[string]string{
+			"ACTIONSLOG_TEST_VAR": "foo",
+		}, readKeyValueFile(t, filepath.Join(dir, "GITHUB_ENV")))
+		require.Equal(t, map[string]string{
+			"state": "a\r\nb",
+		}, readKeyValueFile(t, filepath.Join(dir, "GITHUB_STATE")))
+		gotPath, err := os.ReadFile(filepath.Join(dir, "GITHUB_PATH"))
+		require.NoError(t, err)
+		require.Equal(t, "/my/bin\n", string(gotPath))
+
+		require.Equal(t, "foo", os.Getenv("ACTIONSLOG_TEST_VAR"))
+		require.Equal(t, "/my/bin"+string(os.PathListSeparator)+"/usr/bin", os.Getenv("PATH"))
+	})
+
+	t.Run("legacy commands", func(t *testing.T) {
+		for _, envVar := range []string{"GITHUB_OUTPUT", "GITHUB_ENV", "GITHUB_PATH", "GITHUB_STATE"} {
+			t.Setenv(envVar, "")
+		}
+		t.Setenv("ACTIONSLOG_TEST_VAR", "")
+		t.Setenv("PATH", "/usr/bin")
+		var buf bytes.Buffer
+		w := &actionslog.Wrapper{Output: &buf}
+		require.NoError(t, w.SetOutput("multi", "line 1\nline 2"))
+		require.NoError(t, w.ExportVariable("ACTIONSLOG_TEST_VAR", "50%"))
+		require.NoError(t, w.AddPath("/my/bin"))
+		require.NoError(t, w.SaveState("a:b", "c"))
+		requireEqualString(t, `::set-output name=multi::line 1%0Aline 2
+::set-env name=ACTIONSLOG_TEST_VAR::50%25
+::add-path::/my/bin
+::save-state name=a%3Ab::c
+`, buf.String())
+		require.Equal(t, "50%", os.Getenv("ACTIONSLOG_TEST_VAR"))
+	})
+}
+
+var heredocStart = regexp.MustCompile(`^([^=]+)<<(ghadelimiter_[0-9a-f]{32})$`)
+
+// readKeyValueFile parses a GITHUB_OUTPUT style file. It only supports the heredoc syntax.
+func readKeyValueFile(t *testing.T, filename string) map[string]string {
+	t.Helper()
+	content, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	result := map[string]string{}
+	lines := strings.SplitAfter(string(content), "\n")
+	for len(lines) > 0 && lines[0] != "" {
+		match := heredocStart.FindStringSubmatch(strings.TrimSuffix(lines[0], "\n"))
+		require.NotNil(t, match, "unexpected line %q", lines[0])
+		lines = lines[1:]
+		var value strings.Builder
+		for {
+			require.NotEmpty(t, lines, "missing delimiter")
+			line := lines[0]
+			lines = lines[1:]
+			if line == match[2]+"\n" {
+				break
+			}
+			value.WriteString(line)
+		}
+		result[match[1]] = strings.TrimSuffix(value.String(), "\n")
+	}
+	return result
+}
@@ -0,0 +1,77 @@
+//go:build go1.21
+
+package actionslog
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// Group starts a collapsible group in the GitHub Actions log and returns a function that ends it.
+// It is shorthand for calling Wrapper.Group on logger's handler. When logger's handler isn't a
+// *Wrapper, Group logs name at slog.LevelInfo instead, and the returned function does nothing.
+func Group(ctx context.Context, logger *slog.Logger, name string) (end func()) {
+	w, ok := logger.Handler().(*Wrapper)
+	if !ok {
+		logger.LogAttrs(ctx, slog.LevelInfo, name)
+		return func() {}
+	}
+	return w.Group(name)
+}
+
+// Group writes a ::group:: command to start a collapsible group in the GitHub Actions log and returns
+// a function that writes ::endgroup:: to end it. Calling end more than once is harmless.
+//
+// GitHub doesn't support nested groups, so starting a group while another is open ends the open
+// group and starts one named "<outer> / <inner>". The outer group is started again when the inner
+// group ends. Ending a group also ends any groups that were started inside it.
+//
+// Group does nothing when the Wrapper's Mode resolves to ModeLocal.
+func (w *Wrapper) Group(name string) (end func()) {
+	w.init()
+	root := w.root()
+	if root.local {
+		return func() {}
+	}
+	root.mux.Lock()
+	defer root.mux.Unlock()
+	g := &logGroup{title: name}
+	if len(root.logGroups) > 0 {
+		g.title = root.logGroups[len(root.logGroups)-1].title + " / " + name
+		_ = root.writeCommand("endgroup", "")
+	}
+	root.logGroups = append(root.logGroups, g)
+	_ = root.writeCommand("group", g.title)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			root.endGroup(g)
+		})
+	}
+}
+
+type logGroup struct {
+	title string
+}
+
+// endGroup ends g and any groups nested in it. Only call endGroup on the root Wrapper.
+func (w *Wrapper) endGroup(g *logGroup) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	idx := -1
+	for i := range w.logGroups {
+		if w.logGroups[i] == g {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return
+	}
+	_ = w.writeCommand("endgroup", "")
+	w.logGroups = w.logGroups[:idx]
+	if idx > 0 {
+		_ = w.writeCommand("group", w.logGroups[idx-1].title)
+	}
+}
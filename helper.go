@@ -0,0 +1,19 @@
+//go:build go1.21
+
+package actionslog
+
+import "github.com/willabides/actionslog/internal/callers"
+
+// Helper marks the calling function as a logging helper, similar to testing.T.Helper. When Wrapper or
+// human.Handler computes the source location of a record, helper functions are skipped and the location
+// of the helper's caller is used instead. This works when the record is logged with the plain slog API
+// as long as the handler's Handle method is called on the same goroutine as the log statement.
+func Helper() {
+	callers.Helper(1)
+}
+
+// HelperPackage marks every function in the package with import path pkgPath as a logging helper.
+// See Helper.
+func HelperPackage(pkgPath string) {
+	callers.HelperPackage(pkgPath)
+}
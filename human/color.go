@@ -0,0 +1,158 @@
+//go:build go1.21
+
+package human
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"unicode/utf8"
+
+	"github.com/goccy/go-yaml/lexer"
+	"github.com/goccy/go-yaml/token"
+)
+
+// Color determines whether a Handler writes ANSI color codes.
+type Color int
+
+const (
+	// ColorOff never writes color codes. This is the default.
+	ColorOff Color = iota
+
+	// ColorAuto writes color codes when the NO_COLOR environment variable is empty and either
+	// FORCE_COLOR is set, GITHUB_ACTIONS is "true", or Output is a terminal.
+	ColorAuto
+
+	// ColorOn always writes color codes.
+	ColorOn
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiBlue   = "\x1b[34m"
+	ansiCyan   = "\x1b[36m"
+)
+
+// enabled resolves c for output.
+func (c Color) enabled(output io.Writer) bool {
+	switch c {
+	case ColorOn:
+		return true
+	case ColorAuto:
+	default:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	if v := os.Getenv("FORCE_COLOR"); v != "" && v != "0" && v != "false" {
+		return true
+	}
+	if os.Getenv("GITHUB_ACTIONS") == "true" {
+		return true
+	}
+	f, ok := output.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func levelColor(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return ansiRed
+	case level >= slog.LevelWarn:
+		return ansiYellow
+	case level >= slog.LevelInfo:
+		return ansiGreen
+	default:
+		return ansiBlue
+	}
+}
+
+// appendColored appends p to dst with each line wrapped in color and a reset. Lines are colored
+// separately because the GitHub Actions log viewer doesn't carry colors across lines.
+func appendColored[T []byte | string](dst []byte, p T, color string) []byte {
+	for len(p) > 0 {
+		i := 0
+		for i < len(p) && p[i] != '\n' {
+			i++
+		}
+		if i > 0 {
+			dst = append(dst, color...)
+			dst = append(dst, p[:i]...)
+			dst = append(dst, ansiReset...)
+		}
+		if i < len(p) {
+			dst = append(dst, '\n')
+			i++
+		}
+		p = p[i:]
+	}
+	return dst
+}
+
+// appendColoredKeys appends yml to dst with mapping keys colored. Nothing but color codes is added, so
+// yml is unchanged when they are removed. yml is appended as-is when it can't be tokenized.
+func appendColoredKeys(dst, yml []byte) []byte {
+	keys := yamlKeys(yml)
+	if len(keys) == 0 {
+		return append(dst, yml...)
+	}
+	lineStarts := []int{0}
+	for i, b := range yml {
+		if b == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	// offset converts a token position to an offset in yml. Columns count runes.
+	offset := func(pos *token.Position) int {
+		if pos.Line < 1 || pos.Line > len(lineStarts) || pos.Column < 1 {
+			return -1
+		}
+		i := lineStarts[pos.Line-1]
+		for col := 1; col < pos.Column; col++ {
+			if i >= len(yml) || yml[i] == '\n' {
+				return -1
+			}
+			_, size := utf8.DecodeRune(yml[i:])
+			i += size
+		}
+		return i
+	}
+	last := 0
+	for _, key := range keys {
+		start, end := offset(key.Position), offset(key.Next.Position)
+		if start < last || end <= start || bytes.IndexByte(yml[start:end], '\n') >= 0 {
+			continue
+		}
+		dst = append(dst, yml[last:start]...)
+		dst = append(dst, ansiCyan...)
+		dst = append(dst, yml[start:end]...)
+		dst = append(dst, ansiReset...)
+		last = end
+	}
+	return append(dst, yml[last:]...)
+}
+
+// yamlKeys returns the tokens for mapping keys in yml.
+func yamlKeys(yml []byte) (keys []*token.Token) {
+	defer func() {
+		if recover() != nil {
+			keys = nil
+		}
+	}()
+	for _, tk := range lexer.Tokenize(string(yml)) {
+		if tk.Next != nil && tk.Next.Type == token.MappingValueType && tk.Type != token.MappingValueType {
+			keys = append(keys, tk)
+		}
+	}
+	return keys
+}
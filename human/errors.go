@@ -0,0 +1,132 @@
+//go:build go1.21
+
+package human
+
+import (
+	"runtime"
+	"strconv"
+)
+
+// stackTracer is implemented by errors that record the stack where they were created.
+type stackTracer interface {
+	StackTrace() []uintptr
+}
+
+type multiError interface {
+	Unwrap() []error
+}
+
+// appendYamlError appends err as the value for a key that has already been appended.
+func (h *Handler) appendYamlError(dst []byte, err error) []byte {
+	resources := &h.root().resources
+	buf := resources.borrowBytes()
+	defer resources.returnBytes(buf)
+	var mapping bool
+	placeholder, panicked := catchPanic(func() {
+		*buf, mapping = h.appendErrorNode((*buf)[:0], err)
+	})
+	if panicked {
+		return appendYamlValString(dst, placeholder)
+	}
+	if !mapping {
+		return append(dst, *buf...)
+	}
+	dst = append(dst[:len(dst)-1], '\n') // replace the space after the colon
+	return appendIndented(dst, *buf, "  ")
+}
+
+// appendErrorNode appends err as its message when there are no causes or stack to write and as a
+// mapping with "msg", "causes" and "stack" otherwise. mapping reports which one it is.
+func (h *Handler) appendErrorNode(dst []byte, err error) (_ []byte, mapping bool) {
+	causes, stack := errorChain(err)
+	if h.ExcludeErrorCauses {
+		causes = nil
+	}
+	if !h.AddErrorStack {
+		stack = nil
+	}
+	if len(causes) == 0 && len(stack) == 0 {
+		return appendYamlValString(dst, err.Error()), false
+	}
+	dst = appendYamlKey(dst, "msg")
+	dst = appendYamlValString(dst, err.Error())
+	if len(causes) > 0 {
+		dst = append(dst, "causes:\n"...)
+		_, isMulti := err.(multiError)
+		resources := &h.root().resources
+		buf := resources.borrowBytes()
+		for _, cause := range causes {
+			// Errors in a flattened chain are written as their message because the rest of the chain
+			// follows them. An error that wraps more than one error ends the chain and gets its own causes.
+			_, causeIsMulti := cause.(multiError)
+			var causeMapping bool
+			if isMulti || causeIsMulti {
+				*buf, causeMapping = h.appendErrorNode((*buf)[:0], cause)
+			} else {
+				*buf = appendYamlValString((*buf)[:0], cause.Error())
+			}
+			dst = appendYamlItem(dst, *buf, causeMapping)
+		}
+		resources.returnBytes(buf)
+	}
+	if len(stack) > 0 {
+		dst = append(dst, "stack:\n"...)
+		frames := runtime.CallersFrames(stack)
+		for {
+			frame, more := frames.Next()
+			dst = append(dst, "  - "...)
+			dst = appendYamlScalar(dst, frame.Function+" "+frame.File+":"+strconv.Itoa(frame.Line))
+			dst = append(dst, '\n')
+			if !more {
+				break
+			}
+		}
+	}
+	return dst, true
+}
+
+// errorChain returns the errors that err wraps and the stack trace of the innermost error in err's
+// chain that has one. A chain of errors that each wrap a single error is flattened into causes, so only
+// the last cause, when it wraps more than one error, has causes of its own.
+func errorChain(err error) (causes []error, stack []uintptr) {
+	for {
+		multi, isMulti := err.(multiError)
+		if isMulti && len(causes) > 0 {
+			// the end of the chain is written with its own causes and stack
+			return causes, stack
+		}
+		if st, ok := err.(stackTracer); ok {
+			if pcs := st.StackTrace(); len(pcs) > 0 {
+				stack = pcs
+			}
+		}
+		if isMulti {
+			for _, e := range multi.Unwrap() {
+				if e != nil {
+					causes = append(causes, e)
+				}
+			}
+			return causes, stack
+		}
+		single, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return causes, stack
+		}
+		err = single.Unwrap()
+		if err == nil {
+			return causes, stack
+		}
+		causes = append(causes, err)
+	}
+}
+
+// appendYamlItem appends item as an entry in a sequence indented one level. The lines after the first
+// are aligned with the first when item is a mapping. Otherwise, they are lines of a block scalar, which
+// are already indented.
+func appendYamlItem(dst, item []byte, mapping bool) []byte {
+	dst = append(dst, "  - "...)
+	if mapping {
+		return appendIndented(dst, item, "    ")
+	}
+	return appendIndented(dst, item, "  ")
+}
@@ -9,9 +9,10 @@ import (
 	"golang.org/x/exp/slog"
 	"io"
 	"os"
-	"runtime"
 	"strconv"
 	"sync"
+
+	"github.com/willabides/actionslog/internal/callers"
 )
 
 // Handler is a slog.Handler that writes human-readable log entries.
@@ -23,7 +24,11 @@ import (
 //	  <attributes as yaml>
 //
 // No escaping is done on the message. Attributes are in YAML format with the top level
-// indented to make it visually distinct from the message.
+// indented to make it visually distinct from the message. Strings are quoted when they would
+// otherwise be read back as a different value, so the attributes can be parsed as YAML.
+//
+// When a LogValue, Error, MarshalYAML or MarshalJSON method or ReplaceAttr panics, the panic is
+// recovered and the attribute's value is written as "!PANIC: <value>".
 type Handler struct {
 	// Output is the writer to write to. Defaults to os.Stderr.
 	Output io.Writer
@@ -37,10 +42,31 @@ type Handler struct {
 	// ExcludeLevel, if true, will exclude the level from the output.
 	ExcludeLevel bool
 
-	// AddSource, if true, will add the source file and line number to the output.
+	// AddSource, if true, will add the source file and line number to the output. Functions marked with
+	// actionslog.Helper are skipped.
 	AddSource bool
 
+	// ReplaceAttr is called to rewrite each non-group attribute before it is logged. It works like
+	// slog.HandlerOptions.ReplaceAttr. groups is the path of groups that contain the attribute, and
+	// the built-in attributes with keys "time", "level", "source" and "msg" are passed with no groups
+	// unless they are excluded. The message is written as the first line of the entry no matter what
+	// its key is. When ReplaceAttr returns a zero Attr, the attribute is discarded.
+	ReplaceAttr func(groups []string, a slog.Attr) slog.Attr
+
+	// Color determines whether to write ANSI color codes. When it is enabled, the message is colored by
+	// level, time, level and source are dimmed, and attribute keys are highlighted. Defaults to ColorOff.
+	Color Color
+
+	// ExcludeErrorCauses, if true, will write errors as their message only. Otherwise, errors that wrap
+	// other errors are written as a mapping with the message in "msg" and the wrapped errors in
+	// "causes". Errors that implement a YAML or JSON marshaler are always marshaled instead.
+	ExcludeErrorCauses bool
+
+	// AddErrorStack, if true, will add a "stack" to errors that have a StackTrace() []uintptr method.
+	AddErrorStack bool
+
 	depth         int
+	groups        []string // all groups that have been added
 	pendingGroups []string // groups that have been added but not yet written
 	yaml          []byte
 	rootHandler   *Handler
@@ -48,6 +74,8 @@ type Handler struct {
 	// Below here is only accessed on rootHandler
 	resources resourcePool
 	mu        sync.Mutex
+	colorOnce sync.Once
+	colorOn   bool
 }
 
 func (h *Handler) root() *Handler {
@@ -69,15 +97,20 @@ func (h *Handler) WithGroup(name string) slog.Handler {
 		return h
 	}
 	return &Handler{
-		Output:        h.Output,
-		Level:         h.Level,
-		ExcludeTime:   h.ExcludeTime,
-		ExcludeLevel:  h.ExcludeLevel,
-		AddSource:     h.AddSource,
-		rootHandler:   h.root(),
-		depth:         h.depth + 1,
-		pendingGroups: append(h.pendingGroups, name),
-		yaml:          h.yaml,
+		Output:             h.Output,
+		Level:              h.Level,
+		ExcludeTime:        h.ExcludeTime,
+		ExcludeLevel:       h.ExcludeLevel,
+		AddSource:          h.AddSource,
+		ReplaceAttr:        h.ReplaceAttr,
+		Color:              h.Color,
+		ExcludeErrorCauses: h.ExcludeErrorCauses,
+		AddErrorStack:      h.AddErrorStack,
+		rootHandler:        h.root(),
+		depth:              h.depth + 1,
+		groups:             append(h.groups[:len(h.groups):len(h.groups)], name),
+		pendingGroups:      append(h.pendingGroups, name),
+		yaml:               h.yaml,
 	}
 }
 
@@ -85,18 +118,26 @@ func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
 	root := h.root()
 	resources := &root.resources
 	attrs = resolveAttrs(resources, attrs)
+	if h.ReplaceAttr != nil {
+		attrs = h.replaceAttrs(h.groups, attrs)
+	}
 	if len(attrs) == 0 {
 		return h
 	}
 	return &Handler{
-		Output:       h.Output,
-		Level:        h.Level,
-		ExcludeTime:  h.ExcludeTime,
-		ExcludeLevel: h.ExcludeLevel,
-		AddSource:    h.AddSource,
-		rootHandler:  root,
-		depth:        h.depth,
-		yaml:         h.appendYaml(h.yaml, attrs),
+		Output:             h.Output,
+		Level:              h.Level,
+		ExcludeTime:        h.ExcludeTime,
+		ExcludeLevel:       h.ExcludeLevel,
+		AddSource:          h.AddSource,
+		ReplaceAttr:        h.ReplaceAttr,
+		Color:              h.Color,
+		ExcludeErrorCauses: h.ExcludeErrorCauses,
+		AddErrorStack:      h.AddErrorStack,
+		rootHandler:        root,
+		depth:              h.depth,
+		groups:             h.groups,
+		yaml:               h.appendYaml(h.yaml, attrs),
 	}
 }
 
@@ -104,15 +145,20 @@ func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
 // This is primarily meant for use with [github.com/willabides/actionslog.Wrapper]
 func (h *Handler) WithOutput(output io.Writer) slog.Handler {
 	return &Handler{
-		Output:        output,
-		Level:         h.Level,
-		ExcludeTime:   h.ExcludeTime,
-		ExcludeLevel:  h.ExcludeLevel,
-		AddSource:     h.AddSource,
-		depth:         h.depth,
-		pendingGroups: append([]string{}, h.pendingGroups...),
-		yaml:          append([]byte{}, h.yaml...),
-		rootHandler:   nil, // new Output means this is the root handler now
+		Output:             output,
+		Level:              h.Level,
+		ExcludeTime:        h.ExcludeTime,
+		ExcludeLevel:       h.ExcludeLevel,
+		AddSource:          h.AddSource,
+		ReplaceAttr:        h.ReplaceAttr,
+		Color:              h.Color,
+		ExcludeErrorCauses: h.ExcludeErrorCauses,
+		AddErrorStack:      h.AddErrorStack,
+		depth:              h.depth,
+		groups:             h.groups,
+		pendingGroups:      append([]string{}, h.pendingGroups...),
+		yaml:               append([]byte{}, h.yaml...),
+		rootHandler:        nil, // new Output means this is the root handler now
 	}
 }
 
@@ -120,18 +166,52 @@ func (h *Handler) Handle(_ context.Context, record slog.Record) error {
 	root := h.root()
 	pool := &root.resources
 	entry := pool.borrowBytes()
-	*entry = append(*entry, record.Message...)
-	*entry = append(*entry, '\n')
-	if !h.ExcludeTime && !record.Time.IsZero() {
-		*entry = append(*entry, "  "+slog.TimeKey+": "...)
-		*entry = appendYAMLTime(*entry, record.Time)
+	color := h.ColorEnabled()
+	msg, writeMsg := record.Message, true
+	if h.ReplaceAttr != nil {
+		var attr slog.Attr
+		attr, writeMsg = h.replaceBuiltin(slog.String(slog.MessageKey, msg))
+		msg = attr.Value.String()
+	}
+	if writeMsg {
+		if color {
+			*entry = appendColored(*entry, msg, levelColor(record.Level))
+		} else {
+			*entry = append(*entry, msg...)
+		}
 		*entry = append(*entry, '\n')
 	}
+	metaStart := len(*entry)
+	if !h.ExcludeTime && !record.Time.IsZero() {
+		if h.ReplaceAttr != nil {
+			*entry = h.appendBuiltin(*entry, slog.Time(slog.TimeKey, record.Time.Round(0)))
+		} else {
+			*entry = append(*entry, "  "+slog.TimeKey+": "...)
+			*entry = appendYAMLTime(*entry, record.Time)
+			*entry = append(*entry, '\n')
+		}
+	}
 	if !h.ExcludeLevel {
-		*entry = append(*entry, "  "+slog.LevelKey+": "+record.Level.String()+"\n"...)
+		if h.ReplaceAttr != nil {
+			*entry = h.appendBuiltin(*entry, slog.Any(slog.LevelKey, record.Level))
+		} else {
+			*entry = append(*entry, "  "+slog.LevelKey+": "+record.Level.String()+"\n"...)
+		}
 	}
 	if h.AddSource && record.PC != 0 {
-		*entry = h.appendSource(record, *entry)
+		frame := callers.Frame(record.PC)
+		src := &slog.Source{Function: frame.Function, File: frame.File, Line: frame.Line}
+		if h.ReplaceAttr != nil {
+			*entry = h.appendBuiltin(*entry, slog.Any(slog.SourceKey, src))
+		} else {
+			*entry = appendSource(*entry, slog.SourceKey, src)
+		}
+	}
+	if color && len(*entry) > metaStart {
+		meta := pool.borrowBytes()
+		*meta = append(*meta, (*entry)[metaStart:]...)
+		*entry = appendColored((*entry)[:metaStart], *meta, ansiDim)
+		pool.returnBytes(meta)
 	}
 	*entry = append(*entry, h.yaml...)
 	attrs := pool.borrowAttrs()
@@ -140,55 +220,139 @@ func (h *Handler) Handle(_ context.Context, record slog.Record) error {
 		return true
 	})
 	*attrs = resolveAttrs(pool, *attrs)
+	if h.ReplaceAttr != nil {
+		*attrs = h.replaceAttrs(h.groups, *attrs)
+	}
 
 	if len(*attrs) > 0 {
 		*entry = h.appendYaml(*entry, *attrs)
 	}
 	root.mu.Lock()
-	output := h.Output
-	if output == nil {
-		output = os.Stderr
-	}
-	_, err := output.Write(*entry)
+	_, err := h.output().Write(*entry)
 	root.mu.Unlock()
 	pool.returnBytes(entry)
 	pool.returnAttrs(attrs)
 	return err
 }
 
-func (h *Handler) appendSource(record slog.Record, dst []byte) []byte {
-	ptrs := h.resources.borrowPtrs()
-	*ptrs = append(*ptrs, record.PC)
-	frame, _ := runtime.CallersFrames(*ptrs).Next()
-	if frame.Function == "" && frame.File == "" {
+func (h *Handler) output() io.Writer {
+	if h.Output == nil {
+		return os.Stderr
+	}
+	return h.Output
+}
+
+// ColorEnabled returns true when h writes ANSI color codes. Color is resolved the first time it is called.
+// actionslog.Wrapper uses it to decide whether to remove color codes from annotations.
+func (h *Handler) ColorEnabled() bool {
+	root := h.root()
+	root.colorOnce.Do(func() {
+		root.colorOn = root.Color.enabled(root.output())
+	})
+	return root.colorOn
+}
+
+// appendSource appends src as a top level attribute with the given key. It appends nothing when src
+// has neither a function nor a file.
+func appendSource(dst []byte, key string, src *slog.Source) []byte {
+	if src.Function == "" && src.File == "" {
 		return dst
 	}
-	dst = append(dst, "  "+slog.SourceKey+":\n"...)
-	if frame.Function != "" {
+	dst = appendYamlKey(append(dst, "  "...), key)
+	dst = append(dst[:len(dst)-1], '\n') // replace the space after the colon
+	if src.Function != "" {
 		dst = append(dst, "    function: "...)
-		dst = append(dst, frame.Function...)
+		dst = append(dst, src.Function...)
 		dst = append(dst, '\n')
 	}
-	if frame.File != "" {
+	if src.File != "" {
 		dst = append(dst, "    file: "...)
-		dst = append(dst, frame.File...)
+		dst = append(dst, src.File...)
 		dst = append(dst, '\n')
 	}
-	if frame.Line != 0 {
+	if src.Line != 0 {
 		dst = append(dst, "    line: "...)
-		dst = strconv.AppendInt(dst, int64(frame.Line), 10)
+		dst = strconv.AppendInt(dst, int64(src.Line), 10)
 		dst = append(dst, '\n')
 	}
-	h.resources.returnPtrs(ptrs)
 	return dst
 }
 
+// replaceBuiltin calls ReplaceAttr for one of the built-in attributes. ok is false when the attribute
+// should be discarded.
+func (h *Handler) replaceBuiltin(attr slog.Attr) (_ slog.Attr, ok bool) {
+	attr = h.replaceAttr(nil, attr)
+	return attr, !attr.Equal(slog.Attr{})
+}
+
+// replaceAttr calls ReplaceAttr and resolves the attribute it returns. When ReplaceAttr panics, the
+// attribute keeps its key and its value is a "!PANIC: <value>" string.
+func (h *Handler) replaceAttr(groups []string, attr slog.Attr) slog.Attr {
+	replaced := attr
+	if placeholder, panicked := catchPanic(func() { replaced = h.ReplaceAttr(groups, attr) }); panicked {
+		return slog.String(attr.Key, placeholder)
+	}
+	replaced.Value = resolveValue(replaced.Value)
+	return replaced
+}
+
+// appendBuiltin appends one of the built-in attributes as a top level attribute after passing it
+// through ReplaceAttr.
+func (h *Handler) appendBuiltin(dst []byte, attr slog.Attr) []byte {
+	attr, ok := h.replaceBuiltin(attr)
+	if !ok {
+		return dst
+	}
+	if attr.Value.Kind() == slog.KindAny {
+		switch v := attr.Value.Any().(type) {
+		case *slog.Source:
+			return appendSource(dst, attr.Key, v)
+		case slog.Level:
+			attr.Value = slog.StringValue(v.String())
+		}
+	}
+	resources := &h.root().resources
+	buf := resources.borrowBytes()
+	*buf = h.appendYamlAttr(*buf, attr)
+	dst = appendIndented(dst, *buf, getIndentPrefix(1))
+	resources.returnBytes(buf)
+	return dst
+}
+
+// replaceAttrs applies ReplaceAttr to attrs and to the members of groups in attrs the way slog's
+// built-in handlers do. groups is the path of groups that contain attrs. attrs is modified in place.
+func (h *Handler) replaceAttrs(groups []string, attrs []slog.Attr) []slog.Attr {
+	kept := attrs[:0]
+	for _, attr := range attrs {
+		attr.Value = resolveValue(attr.Value)
+		if attr.Value.Kind() == slog.KindGroup {
+			memberGroups := groups
+			if attr.Key != "" {
+				memberGroups = append(groups[:len(groups):len(groups)], attr.Key)
+			}
+			members := h.replaceAttrs(memberGroups, append([]slog.Attr{}, attr.Value.Group()...))
+			if len(members) == 0 {
+				continue
+			}
+			attr.Value = slog.GroupValue(members...)
+		} else {
+			attr = h.replaceAttr(groups, attr)
+			if attr.Equal(slog.Attr{}) {
+				continue
+			}
+		}
+		kept = append(kept, attr)
+	}
+	return kept
+}
+
 func (h *Handler) appendYaml(dst []byte, attrs []slog.Attr) []byte {
 	resources := &h.root().resources
 	attrs = resolveAttrs(resources, attrs)
 	if len(attrs) == 0 {
 		return dst
 	}
+	start := len(dst)
 	indents := 1 + h.depth - len(h.pendingGroups)
 	for i := 0; i < len(h.pendingGroups); i++ {
 		prefix := getIndentPrefix(indents)
@@ -198,22 +362,32 @@ func (h *Handler) appendYaml(dst []byte, attrs []slog.Attr) []byte {
 	prefix := getIndentPrefix(indents)
 	buf := resources.borrowBytes()
 	for _, attr := range attrs {
-		*buf = appendYamlAttr(resources, *buf, attr)
-		for _, b := range *buf {
-			if len(dst) == 0 || dst[len(dst)-1] == '\n' {
-				dst = append(dst, prefix...)
-			}
-			dst = append(dst, b)
-		}
+		*buf = h.appendYamlAttr(*buf, attr)
+		dst = appendIndented(dst, *buf, prefix)
 		*buf = (*buf)[:0]
 	}
+	if h.ColorEnabled() {
+		*buf = append(*buf, dst[start:]...)
+		dst = appendColoredKeys(dst[:start], *buf)
+	}
 	resources.returnBytes(buf)
 	return dst
 }
 
+// appendIndented appends p to dst with prefix added at the start of each line.
+func appendIndented(dst, p []byte, prefix string) []byte {
+	for _, b := range p {
+		if len(dst) == 0 || dst[len(dst)-1] == '\n' {
+			dst = append(dst, prefix...)
+		}
+		dst = append(dst, b)
+	}
+	return dst
+}
+
 // resolveAttrs resolves members of attrs.
 // Resolving entails:
-//   - Calling Resolve() on any LogValuer or Any values
+//   - Resolving any LogValuer or Any values with resolveValue
 //   - Inlining groups with empty keys
 //   - Omitting zero-value Attrs
 func resolveAttrs(resources *resourcePool, attrs []slog.Attr) []slog.Attr {
@@ -221,7 +395,7 @@ func resolveAttrs(resources *resourcePool, attrs []slog.Attr) []slog.Attr {
 	for _, attr := range attrs {
 		kind := attr.Value.Kind()
 		if kind == slog.KindLogValuer || kind == slog.KindAny {
-			attr.Value = attr.Value.Resolve()
+			attr.Value = resolveValue(attr.Value)
 			kind = attr.Value.Kind()
 		}
 		// inline groups with empty keys
@@ -240,25 +414,8 @@ func resolveAttrs(resources *resourcePool, attrs []slog.Attr) []slog.Attr {
 }
 
 type resourcePool struct {
-	mapPool   sync.Pool
 	bytesPool sync.Pool
 	attrsPool sync.Pool
-	ptrPool   sync.Pool
-}
-
-func (p *resourcePool) borrowMap() map[string]any {
-	v := p.mapPool.Get()
-	if v == nil {
-		return map[string]any{}
-	}
-	return v.(map[string]any)
-}
-
-func (p *resourcePool) returnMap(v map[string]any) {
-	for k := range v {
-		delete(v, k)
-	}
-	p.mapPool.Put(v)
 }
 
 func (p *resourcePool) borrowBytes() *[]byte {
@@ -288,17 +445,3 @@ func (p *resourcePool) returnAttrs(v *[]slog.Attr) {
 	*v = (*v)[:0]
 	p.attrsPool.Put(v)
 }
-
-func (p *resourcePool) borrowPtrs() *[]uintptr {
-	v := p.ptrPool.Get()
-	if v == nil {
-		ptrs := make([]uintptr, 0, 16)
-		return &ptrs
-	}
-	return v.(*[]uintptr)
-}
-
-func (p *resourcePool) returnPtrs(v *[]uintptr) {
-	*v = (*v)[:0]
-	p.ptrPool.Put(v)
-}
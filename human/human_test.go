@@ -4,17 +4,26 @@ package human_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
 	"time"
+	"unicode/utf8"
 
+	"github.com/goccy/go-yaml"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/willabides/actionslog/human"
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
 func ExampleHandler() {
@@ -148,4 +157,350 @@ hi
 		got := strings.TrimSpace(buf.String())
 		require.Equal(t, want, got)
 	})
+
+	t.Run("ReplaceAttr", func(t *testing.T) {
+		var buf bytes.Buffer
+		var calls []string
+		logger := slog.New(&human.Handler{
+			Output:    &buf,
+			AddSource: true,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				calls = append(calls, strings.Join(append(groups, a.Key), "."))
+				switch {
+				case len(groups) == 0 && a.Key == slog.TimeKey:
+					return slog.Attr{}
+				case len(groups) == 0 && a.Key == slog.LevelKey:
+					return slog.String("lvl", strings.ToLower(a.Value.Any().(slog.Level).String()))
+				case len(groups) == 0 && a.Key == slog.SourceKey:
+					src := a.Value.Any().(*slog.Source)
+					return slog.String(a.Key, filepath.Base(src.File))
+				case len(groups) == 0 && a.Key == slog.MessageKey:
+					return slog.String(a.Key, strings.ToUpper(a.Value.String()))
+				case a.Key == "password":
+					return slog.String(a.Key, "REDACTED")
+				case a.Key == "drop":
+					return slog.Attr{}
+				}
+				return a
+			},
+		})
+		logger = logger.With(slog.String("password", "top"), slog.String("drop", "x"))
+		logger = logger.WithGroup("g1").With(slog.Group("creds", slog.String("password", "hunter2")))
+		logger = logger.WithGroup("g2")
+		logger.Info("hello", slog.String("drop", "y"), slog.Group("empty", slog.String("drop", "z")), slog.Int("num", 1))
+		_, thisFile, _, _ := runtime.Caller(0)
+		require.Equal(t, `HELLO
+  lvl: info
+  source: `+filepath.Base(thisFile)+`
+  password: REDACTED
+  g1:
+    creds:
+      password: REDACTED
+    g2:
+      num: 1
+`, buf.String())
+		require.Equal(t, []string{
+			"password", "drop",
+			"g1.creds.password",
+			"msg", "time", "level", "source",
+			"g1.g2.drop", "g1.g2.empty.drop", "g1.g2.num",
+		}, calls)
+
+		buf.Reset()
+		logger = slog.New(&human.Handler{
+			Output:       &buf,
+			ExcludeTime:  true,
+			ExcludeLevel: true,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.MessageKey {
+					return slog.Attr{}
+				}
+				return a
+			},
+		})
+		logger.Info("hello", slog.String("a", "b"))
+		require.Equal(t, "  a: b\n", buf.String())
+	})
+
+	t.Run("Color", func(t *testing.T) {
+		logAll := func(color human.Color) string {
+			var buf bytes.Buffer
+			var handler slog.Handler = &human.Handler{
+				Output:    &buf,
+				Level:     slog.LevelDebug,
+				AddSource: true,
+				Color:     color,
+			}
+			handler = handler.WithAttrs([]slog.Attr{slog.String("foo", "bar")})
+			handler = handler.WithGroup("g1")
+			handler = handler.WithAttrs([]slog.Attr{slog.Any("thing", map[string]any{
+				"a": "x: y",
+				"b": []string{"c", "d"},
+				"é": map[string]int{"f": 1},
+			})})
+			for i, level := range []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError} {
+				var pcs [1]uintptr
+				runtime.Callers(1, pcs[:])
+				record := slog.NewRecord(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), level, "line 1\nline 2", pcs[0])
+				record.AddAttrs(
+					slog.Int("i", i),
+					slog.String("multiline", "first line\nsecond line"),
+					slog.Group("grp", slog.String("key: with colon", "v")),
+				)
+				require.NoError(t, handler.Handle(context.Background(), record))
+			}
+			return buf.String()
+		}
+		plain := logAll(human.ColorOff)
+		colored := logAll(human.ColorOn)
+		require.NotContains(t, plain, "\x1b")
+		require.Equal(t, plain, stripANSI(colored))
+		require.Contains(t, colored, "\x1b[31mline 1\x1b[0m\n\x1b[31mline 2\x1b[0m\n\x1b[2m  time: ")
+		require.Contains(t, colored, "\x1b[36mfoo\x1b[0m: bar\n")
+		require.Contains(t, colored, "      \x1b[36mé\x1b[0m:\n        \x1b[36mf\x1b[0m: 1\n")
+		require.Contains(t, colored, "\x1b[36mmultiline\x1b[0m: |-\n      first line\n      second line\n")
+	})
+
+	t.Run("ColorAuto", func(t *testing.T) {
+		for _, td := range []struct {
+			noColor, forceColor, githubActions string
+			want                               bool
+		}{
+			{want: false},
+			{forceColor: "1", want: true},
+			{forceColor: "0", want: false},
+			{githubActions: "true", want: true},
+			{noColor: "1", forceColor: "1", githubActions: "true", want: false},
+		} {
+			t.Setenv("NO_COLOR", td.noColor)
+			t.Setenv("FORCE_COLOR", td.forceColor)
+			t.Setenv("GITHUB_ACTIONS", td.githubActions)
+			var buf bytes.Buffer
+			logger := slog.New(&human.Handler{Output: &buf, Color: human.ColorAuto})
+			logger.Info("hello")
+			require.Equal(t, td.want, strings.Contains(buf.String(), "\x1b["), "%+v", td)
+		}
+	})
+
+	t.Run("Any", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := slog.New(&human.Handler{
+			Output:       &buf,
+			ExcludeTime:  true,
+			ExcludeLevel: true,
+		})
+		logger.Info("any",
+			slog.Any("map", map[string]int{"a": 1}),
+			slog.Any("slice", []string{"a"}),
+			slog.Any("struct", struct{ F int }{F: 1}),
+			slog.Any("emptyMap", map[string]int{}),
+			slog.Any("emptySlice", []string{}),
+			slog.Any("multiline", struct{ F string }{F: "multi\nline"}),
+		)
+		require.Equal(t, `any
+  map:
+    a: 1
+  slice:
+    - a
+  struct:
+    f: 1
+  emptyMap: {}
+  emptySlice: []
+  multiline:
+    f: |-
+      multi
+      line
+`, buf.String())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		var buf bytes.Buffer
+		handler := &human.Handler{
+			Output:       &buf,
+			ExcludeTime:  true,
+			ExcludeLevel: true,
+		}
+		logger := slog.New(handler)
+		wrapped := fmt.Errorf("read config: %w", fmt.Errorf("open config.yml: %w", os.ErrNotExist))
+		joined := errors.Join(errors.New("first"), fmt.Errorf("second: %w", errors.New("inner")), errors.New("multi\nline"))
+		logger.Info("errors",
+			slog.Any("plain", errors.New("plain: true")),
+			slog.Any("wrapped", wrapped),
+			slog.Any("joined", fmt.Errorf("failed: %w", joined)),
+		)
+		require.Equal(t, `errors
+  plain: "plain: true"
+  wrapped:
+    msg: "read config: open config.yml: file does not exist"
+    causes:
+      - "open config.yml: file does not exist"
+      - file does not exist
+  joined:
+    msg: |-
+      failed: first
+      second: inner
+      multi
+      line
+    causes:
+      - msg: |-
+          first
+          second: inner
+          multi
+          line
+        causes:
+          - first
+          - msg: "second: inner"
+            causes:
+              - inner
+          - |-
+            multi
+            line
+`, buf.String())
+		var got map[string]any
+		_, attrs, _ := strings.Cut(buf.String(), "\n")
+		require.NoError(t, yaml.Unmarshal([]byte(attrs), &got))
+		require.Equal(t, "multi\nline", got["joined"].(map[string]any)["causes"].([]any)[0].(map[string]any)["causes"].([]any)[2])
+
+		buf.Reset()
+		handler.ExcludeErrorCauses = true
+		handler.AddErrorStack = true
+		_, thisFile, line, _ := runtime.Caller(0)
+		err := &stackError{msg: "with stack"}
+		err.pcs = make([]uintptr, 1)
+		runtime.Callers(1, err.pcs)
+		frame, _ := runtime.CallersFrames(err.pcs).Next()
+		logger.Info("errors", slog.Any("wrapped", wrapped), slog.Any("stack", fmt.Errorf("wrapped: %w", err)))
+		require.Equal(t, `errors
+  wrapped: "read config: open config.yml: file does not exist"
+  stack:
+    msg: "wrapped: with stack"
+    stack:
+      - `+frame.Function+" "+thisFile+":"+strconv.Itoa(line+3)+`
+`, buf.String())
+	})
+
+	t.Run("panics", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := slog.New(&human.Handler{
+			Output:       &buf,
+			ExcludeTime:  true,
+			ExcludeLevel: true,
+			ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+				if a.Key == "replace" {
+					panic("ReplaceAttr")
+				}
+				return a
+			},
+		})
+		logger = logger.With(slog.Any("with", panicValuer{}))
+		logger.Info("hello",
+			slog.Any("valuer", panicValuer{}),
+			slog.Any("error", panicError{}),
+			slog.Any("joined", errors.Join(errors.New("ok"), panicError{})),
+			slog.Any("yaml", panicYAML{}),
+			slog.Any("json", panicJSON{}),
+			slog.String("replace", "x"),
+			slog.Group("g", slog.Any("valuer", panicValuer{})),
+			slog.String("after", "still here"),
+		)
+		require.Equal(t, `hello
+  with: "!PANIC: LogValue"
+  valuer: "!PANIC: LogValue"
+  error: "!PANIC: Error"
+  joined: "!PANIC: Error"
+  yaml: "!PANIC: MarshalYAML"
+  json: "!PANIC: MarshalJSON"
+  replace: "!PANIC: ReplaceAttr"
+  g:
+    valuer: "!PANIC: LogValue"
+  after: still here
+`, buf.String())
+	})
+}
+
+type panicValuer struct{}
+
+func (panicValuer) LogValue() slog.Value { panic("LogValue") }
+
+type panicError struct{}
+
+func (panicError) Error() string { panic("Error") }
+
+type panicYAML struct{}
+
+func (panicYAML) MarshalYAML() (any, error) { panic("MarshalYAML") }
+
+type panicJSON struct{}
+
+func (panicJSON) MarshalJSON() ([]byte, error) { panic("MarshalJSON") }
+
+type stackError struct {
+	msg string
+	pcs []uintptr
+}
+
+func (e *stackError) Error() string { return e.msg }
+
+func (e *stackError) StackTrace() []uintptr { return e.pcs }
+
+var ansiPattern = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+func stripANSI(s string) string {
+	return ansiPattern.ReplaceAllString(s, "")
+}
+
+func FuzzHandler(f *testing.F) {
+	for _, s := range []string{
+		"", "true", "null", "~", "123", "-1.5e3", "0x1F", "- item", "-", "? x", "#comment", "{x}", "[x]",
+		"*alias", "&anchor", "!tag", "|", ">", "'single'", `"double"`, "a: b", "a:b", "a #b", "trailing:",
+		" padded ", "tab\there", "line1\nline2", "line1\r\nline2", "\nleading", "trailing\n", "a\n b\n  c",
+		"<<", "yes", "2021-01-01", "\x00\x1b[31m", " ", "\ufeffbom", "back\\slash", "%percent", "@at", "`tick",
+	} {
+		f.Add(s, s)
+	}
+	f.Fuzz(func(t *testing.T, key, value string) {
+		if !utf8.ValidString(key) || !utf8.ValidString(value) {
+			t.Skip()
+		}
+		switch key {
+		case "g", "map", "slice", "struct":
+			t.Skip()
+		}
+		var buf bytes.Buffer
+		logger := slog.New(&human.Handler{
+			Output:       &buf,
+			ExcludeTime:  true,
+			ExcludeLevel: true,
+		})
+		logger.Info("msg",
+			slog.String(key, value),
+			slog.Group("g", slog.String(key, value)),
+			slog.Any("map", map[string]string{"a": "b"}),
+			slog.Any("slice", []string{"a"}),
+			slog.Any("struct", struct{ F string }{F: "x"}),
+		)
+		_, attrs, ok := strings.Cut(buf.String(), "\n")
+		require.True(t, ok)
+		want := map[string]any{
+			key:      value,
+			"g":      map[string]any{key: value},
+			"map":    map[string]any{"a": "b"},
+			"slice":  []any{"a"},
+			"struct": map[string]any{"f": "x"},
+		}
+		var got map[string]any
+		err := yaml.Unmarshal([]byte(attrs), &got)
+		require.NoError(t, err, attrs)
+		require.Equal(t, want, got, attrs)
+		// go-yaml accepts some invalid YAML like "a: b: c", so check with a stricter parser too. Keys are
+		// written as implicit keys, which YAML limits to 1024 characters, because go-yaml can't read
+		// explicit keys. An escaped character takes up to 6, so skip keys that could go over the limit.
+		if len(key) > 1022/6 {
+			return
+		}
+		got = nil
+		err = yamlv3.Unmarshal([]byte(attrs), &got)
+		require.NoError(t, err, attrs)
+		require.Equal(t, want, got, attrs)
+	})
 }
@@ -0,0 +1,42 @@
+//go:build go1.21
+
+package human
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// maxLogValues is the number of LogValue calls resolveValue makes before leaving the rest to
+// slog.Value.Resolve.
+const maxLogValues = 100
+
+// resolveValue is like slog.Value.Resolve, but when a LogValue method panics the value resolves to a
+// "!PANIC: <value>" string instead of an error with a stack trace.
+func resolveValue(v slog.Value) (rv slog.Value) {
+	defer func() {
+		if r := recover(); r != nil {
+			rv = slog.StringValue(panicPlaceholder(r))
+		}
+	}()
+	for i := 0; i < maxLogValues && v.Kind() == slog.KindLogValuer; i++ {
+		v = v.LogValuer().LogValue()
+	}
+	return v.Resolve()
+}
+
+// catchPanic calls fn, which renders a value with user code such as an Error or MarshalYAML method.
+// When fn panics, placeholder is the text to write in place of the value.
+func catchPanic(fn func()) (placeholder string, panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			placeholder, panicked = panicPlaceholder(r), true
+		}
+	}()
+	fn()
+	return "", false
+}
+
+func panicPlaceholder(r any) string {
+	return fmt.Sprintf("!PANIC: %v", r)
+}
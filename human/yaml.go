@@ -11,8 +11,14 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/printer"
+	"github.com/goccy/go-yaml/token"
+	"github.com/willabides/actionslog/internal/yamlquote"
 )
 
 var (
@@ -33,54 +39,115 @@ func getIndentPrefix(indents int) string {
 	return strings.Repeat("  ", indents)
 }
 
-func appendYamlAttr(resources *resourcePool, dst []byte, attr slog.Attr) []byte {
+func (h *Handler) appendYamlAttr(dst []byte, attr slog.Attr) []byte {
 	kind := attr.Value.Kind()
 	if kind == slog.KindAny || kind == slog.KindLogValuer {
-		attr.Value = attr.Value.Resolve()
+		attr.Value = resolveValue(attr.Value)
 		kind = attr.Value.Kind()
 	}
 	if kind == slog.KindAny {
-		return appendYamlAnyAttr(resources, dst, attr)
+		return h.appendYamlAnyAttr(dst, attr)
 	}
 	dst = appendYamlKey(dst, attr.Key)
-	return appendYamlValue(resources, dst, attr.Value)
+	return h.appendYamlValue(dst, attr.Value)
 }
 
+// appendYamlKey appends key as an implicit mapping key. YAML limits implicit keys to 1024 characters,
+// but longer keys are written the same way because go-yaml can't read explicit "? key" mapping keys.
 func appendYamlKey(dst []byte, key string) []byte {
-	key = strings.TrimSpace(key)
-	if key == "" {
-		return append(dst, `"": `...)
-	}
-	if strings.ContainsAny(key, ":\t\r\n") {
-		dst = strconv.AppendQuote(dst, key)
-	} else {
-		dst = append(dst, key...)
-	}
+	dst = appendYamlScalar(dst, key)
 	return append(dst, ": "...)
 }
 
-func appendYamlValString(resources *resourcePool, dst []byte, s string) []byte {
-	s = strings.TrimSpace(s)
-	if strings.ContainsAny(s, "\n\r\t:") || s == "" {
-		bufBytes := resources.borrowBytes()
-		buf := bytes.NewBuffer(*bufBytes)
-		err := yaml.NewEncoder(buf, yaml.Indent(2)).Encode(s)
-		if err != nil {
-			buf.Reset()
-			buf.WriteString(strconv.Quote("!BAD STRING " + s))
+func appendYamlValString(dst []byte, s string) []byte {
+	if isBlockSafe(s) {
+		dst = append(dst, "|-"...)
+		for len(s) > 0 {
+			line, rest, _ := strings.Cut(s, "\n")
+			dst = append(dst, '\n')
+			if line != "" {
+				dst = append(dst, "  "...)
+				dst = append(dst, line...)
+			}
+			s = rest
 		}
-		dst = append(dst, buf.Bytes()...)
-		*bufBytes = buf.Bytes()
 	} else {
-		dst = append(dst, s...)
+		dst = appendYamlScalar(dst, s)
 	}
-	if len(dst) != 0 || dst[len(dst)-1] != '\n' {
-		dst = append(dst, '\n')
+	return append(dst, '\n')
+}
+
+// appendYamlScalar appends s as a plain scalar when it would be read back as the same string and as a
+// double-quoted scalar otherwise.
+func appendYamlScalar(dst []byte, s string) []byte {
+	if needsQuotes(s) {
+		return yamlquote.Append(dst, s)
 	}
-	return dst
+	return append(dst, s...)
+}
+
+// needsQuotes returns true when s can't be written as a plain scalar because it would be read as
+// something other than the string s or wouldn't be valid YAML.
+func needsQuotes(s string) bool {
+	if token.IsNeedQuoted(s) || !utf8.ValidString(s) {
+		return true
+	}
+	switch s {
+	case "null", "Null", "NULL", "~":
+		return true
+	}
+	// go-yaml reads "<<" as a merge key even in the middle of a plain scalar.
+	if strings.Contains(s, "<<") {
+		return true
+	}
+	switch s[0] {
+	case '-', '?', ':':
+		if len(s) == 1 || s[1] == ' ' {
+			return true
+		}
+	case '#', '`':
+		return true
+	}
+	// Be conservative with anything that might be read as a number.
+	if strings.ContainsRune("0123456789+-.", rune(s[0])) {
+		return true
+	}
+	if s[0] == ' ' || s[len(s)-1] == ' ' {
+		return true
+	}
+	for _, r := range s {
+		if r != ' ' && !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
 }
 
-func appendYamlValue(resources *resourcePool, dst []byte, val slog.Value) []byte {
+// isBlockSafe returns true when s is a multi-line string that can be written as a literal block scalar
+// and read back unchanged.
+func isBlockSafe(s string) bool {
+	if !strings.Contains(s, "\n") || !utf8.ValidString(s) {
+		return false
+	}
+	// Leading white space would be taken for indentation, trailing white space is removed with the
+	// trailing newline, and "|-" strips trailing newlines.
+	switch s[0] {
+	case ' ', '\t', '\n':
+		return false
+	}
+	switch s[len(s)-1] {
+	case ' ', '\t', '\n':
+		return false
+	}
+	for _, r := range s {
+		if r != ' ' && r != '\n' && !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *Handler) appendYamlValue(dst []byte, val slog.Value) []byte {
 	switch val.Kind() {
 	case slog.KindInt64:
 		dst = strconv.AppendInt(dst, val.Int64(), 10)
@@ -95,17 +162,17 @@ func appendYamlValue(resources *resourcePool, dst []byte, val slog.Value) []byte
 	case slog.KindTime:
 		dst = appendYAMLTime(dst, val.Time())
 	case slog.KindString:
-		dst = appendYamlValString(resources, dst, val.String())
+		dst = appendYamlValString(dst, val.String())
 	case slog.KindGroup:
 		// remove trailing space after ":" if any
 		if len(dst) > 1 && dst[len(dst)-1] == ' ' && dst[len(dst)-2] == ':' {
 			dst = dst[:len(dst)-1]
 		}
 		dst = append(dst, "\n  "...)
+		resources := &h.root().resources
 		b := resources.borrowBytes()
 		for _, a := range val.Group() {
-			*b = appendYamlAttr(
-				resources,
+			*b = h.appendYamlAttr(
 				(*b)[:0],
 				a,
 			)
@@ -118,7 +185,7 @@ func appendYamlValue(resources *resourcePool, dst []byte, val slog.Value) []byte
 		}
 		resources.returnBytes(b)
 	default:
-		dst = appendYamlValString(resources, dst, "!ERROR unknown kind: "+val.String())
+		dst = appendYamlValString(dst, "!ERROR unknown kind: "+val.String())
 	}
 	dst = bytes.TrimRight(dst, " \t\r\n")
 	if len(dst) != 0 || dst[len(dst)-1] != '\n' {
@@ -129,7 +196,7 @@ func appendYamlValue(resources *resourcePool, dst []byte, val slog.Value) []byte
 
 // appendYamlAnyAttr appends both key and value. We need to do it this way because we don't know
 // what the yaml formatting will be ahead of time.
-func appendYamlAnyAttr(resources *resourcePool, dst []byte, attr slog.Attr) []byte {
+func (h *Handler) appendYamlAnyAttr(dst []byte, attr slog.Attr) []byte {
 	val := attr.Value.Any()
 	// use errors' error message only if it doesn't implement one of these marshalers
 	switch v := val.(type) {
@@ -140,30 +207,46 @@ func appendYamlAnyAttr(resources *resourcePool, dst []byte, attr slog.Attr) []by
 		json.Marshaler:
 	case error:
 		dst = appendYamlKey(dst, attr.Key)
-		dst = appendYamlValString(resources, dst, v.Error())
-		dst = bytes.TrimRight(dst, " \t\r\n")
-		if len(dst) != 0 || dst[len(dst)-1] != '\n' {
-			dst = append(dst, '\n')
-		}
-		return dst
+		return h.appendYamlError(dst, v)
 	}
 
-	bufBytes := resources.borrowBytes()
-	buf := bytes.NewBuffer(*bufBytes)
-	mp := resources.borrowMap()
-	defer resources.returnMap(mp)
-	mp[attr.Key] = val
-	err := yaml.NewEncoder(buf, yaml.UseJSONMarshaler(), yaml.Indent(2)).Encode(mp)
+	var node ast.Node
+	var err error
+	placeholder, panicked := catchPanic(func() {
+		node, err = yaml.NewEncoder(nil, yaml.UseJSONMarshaler(), yaml.Indent(2)).EncodeToNode(val)
+	})
+	dst = appendYamlKey(dst, attr.Key)
+	if panicked {
+		return appendYamlValString(dst, placeholder)
+	}
 	if err != nil {
-		dst = appendYamlKey(dst, attr.Key)
-		return appendYamlValString(resources, dst, fmt.Sprintf("!ERROR encoding: %s", err.Error()))
+		return appendYamlValString(dst, fmt.Sprintf("!ERROR encoding: %s", err.Error()))
 	}
-	dst = append(dst, buf.Bytes()...)
-	dst = bytes.TrimRight(dst, " \t\r\n")
-	if len(dst) != 0 || dst[len(dst)-1] != '\n' {
-		dst = append(dst, '\n')
+	var p printer.Printer
+	encoded := bytes.TrimRight(p.PrintNode(node), " \t\r\n")
+	// Block collections go on the lines after the key. Scalars, including block scalars, and flow
+	// collections start on the same line.
+	if isBlockCollection(node) {
+		dst = append(dst[:len(dst)-1], '\n') // replace the space after the colon
+		dst = appendIndented(dst, encoded, "  ")
+	} else {
+		dst = append(dst, encoded...)
 	}
-	return dst
+	return append(dst, '\n')
+}
+
+// isBlockCollection returns true when node is a mapping or sequence in block style, which can't start on
+// the same line as its key. Empty collections are written as {} or [].
+func isBlockCollection(node ast.Node) bool {
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		return !n.IsFlowStyle && len(n.Values) > 0
+	case *ast.MappingValueNode:
+		return true
+	case *ast.SequenceNode:
+		return !n.IsFlowStyle && len(n.Values) > 0
+	}
+	return false
 }
 
 // Adapted from log/slog.appendJSONTime in go stdlib.
@@ -0,0 +1,101 @@
+//go:build go1.21
+
+// Package callers finds the source location of log statements while skipping helper functions.
+package callers
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	helperFuncs    sync.Map // map[string]struct{}
+	helperPackages sync.Map // map[string]struct{}
+	haveHelpers    atomic.Bool
+)
+
+// Helper marks the function skip frames above the caller of Helper as a helper. Helper(0) marks the
+// function that called Helper.
+func Helper(skip int) {
+	var pcs [1]uintptr
+	if runtime.Callers(skip+2, pcs[:]) == 0 {
+		return
+	}
+	frame, _ := runtime.CallersFrames(pcs[:]).Next()
+	if frame.Function == "" {
+		return
+	}
+	helperFuncs.Store(frame.Function, struct{}{})
+	haveHelpers.Store(true)
+}
+
+// HelperPackage marks every function in the package with import path pkgPath as a helper.
+func HelperPackage(pkgPath string) {
+	helperPackages.Store(pkgPath, struct{}{})
+	haveHelpers.Store(true)
+}
+
+// IsHelper returns true if function is the name of a helper function as reported by runtime.Frame.Function.
+func IsHelper(function string) bool {
+	if !haveHelpers.Load() || function == "" {
+		return false
+	}
+	if _, ok := helperFuncs.Load(function); ok {
+		return true
+	}
+	_, ok := helperPackages.Load(funcPackage(function))
+	return ok
+}
+
+// funcPackage returns the import path of the package function is in.
+func funcPackage(function string) string {
+	slash := strings.LastIndexByte(function, '/')
+	dot := strings.IndexByte(function[slash+1:], '.')
+	if dot < 0 {
+		return function
+	}
+	return function[:slash+1+dot]
+}
+
+// maxDepth is how far up the stack Frame looks for pc.
+const maxDepth = 64
+
+// Frame returns the first frame for pc that isn't a helper. When pc is on the current goroutine's stack,
+// pc's callers are considered as well as functions inlined at pc. That is the case when Frame is called
+// from a slog.Handler with the PC of the record it is handling. Frame returns the first frame for pc when
+// all frames are helpers.
+func Frame(pc uintptr) runtime.Frame {
+	pcs := []uintptr{pc}
+	if haveHelpers.Load() {
+		pcs = stackFrom(pc)
+	}
+	frames := runtime.CallersFrames(pcs)
+	var first runtime.Frame
+	for i := 0; ; i++ {
+		frame, more := frames.Next()
+		if i == 0 {
+			first = frame
+		}
+		if !IsHelper(frame.Function) {
+			return frame
+		}
+		if !more {
+			return first
+		}
+	}
+}
+
+// stackFrom returns the current goroutine's stack starting at pc. It returns []uintptr{pc} when pc isn't
+// on the stack.
+func stackFrom(pc uintptr) []uintptr {
+	pcs := make([]uintptr, maxDepth)
+	pcs = pcs[:runtime.Callers(2, pcs)]
+	for i := range pcs {
+		if pcs[i] == pc {
+			return pcs[i:]
+		}
+	}
+	return []uintptr{pc}
+}
@@ -0,0 +1,98 @@
+//go:build go1.21
+
+// Package yamlquote writes YAML double-quoted scalars that go-yaml reads back unchanged. It only uses
+// escapes that go-yaml reads correctly, which rules out \t, \r and \x.
+package yamlquote
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Append appends s as a double-quoted scalar.
+func Append(dst []byte, s string) []byte {
+	start := len(dst)
+	dst = append(dst, '"')
+	dst = AppendEscaped(dst, s)
+	// Escaping the colon moves it out of reach without moving where go-yaml looks.
+	if i := misreadColon(dst[start+1:]); i >= 0 {
+		i += start + 1
+		dst = append(dst[:i], append([]byte(`\u003a`), dst[i+1:]...)...)
+	}
+	return append(dst, '"')
+}
+
+// AppendEscaped appends the body of a double-quoted scalar for s without the quotes. Unlike Append, it
+// escapes each character of s the same way wherever it is, so it can be used to find how a substring of
+// s is written.
+func AppendEscaped(dst []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			// invalid UTF-8 can't be represented, so write the byte as a code point instead
+			r = rune(s[i])
+			dst = append(dst, '\\', 'u', '0', '0', hex[r>>4], hex[r&0xf])
+		case r == '"' || r == '\\':
+			dst = append(dst, '\\', byte(r))
+		case r == '\n':
+			dst = append(dst, '\\', 'n')
+		case r == '\t':
+			// tabs are allowed in double-quoted scalars, and masks for secrets still match them
+			dst = append(dst, '\t')
+		case r == ' ' || unicode.IsPrint(r):
+			dst = append(dst, s[i:i+size]...)
+		case r <= 0xffff:
+			dst = append(dst, '\\', 'u')
+			for shift := 12; shift >= 0; shift -= 4 {
+				dst = append(dst, hex[r>>shift&0xf])
+			}
+		default:
+			dst = append(dst, '\\', 'U')
+			for shift := 28; shift >= 0; shift -= 4 {
+				dst = append(dst, hex[r>>shift&0xf])
+			}
+		}
+		i += size
+	}
+	return dst
+}
+
+// misreadColon returns the offset of the ':' in the body of a double-quoted scalar that go-yaml would
+// mistake for the start of a mapping value, or -1 if there isn't one. go-yaml doesn't count the
+// characters of escape sequences after the backslash, so after the closing quote it looks for ':'
+// that many characters too early.
+func misreadColon(body []byte) int {
+	var offsets []int
+	behind := 0
+	for i := 0; i < len(body); {
+		size := 1
+		switch {
+		case body[i] == '\\' && i+1 < len(body):
+			size = 2
+			switch body[i+1] {
+			case 'u':
+				size = 6
+			case 'U':
+				size = 10
+			}
+			behind += size - 1
+			for j := 0; j < size; j++ {
+				offsets = append(offsets, i+j)
+			}
+		default:
+			_, size = utf8.DecodeRune(body[i:])
+			offsets = append(offsets, i)
+		}
+		i += size
+	}
+	n := len(offsets) - behind + 1
+	for n >= 0 && n < len(offsets) && body[offsets[n]] == ' ' {
+		n++
+	}
+	if n >= 0 && n < len(offsets) && body[offsets[n]] == ':' {
+		return offsets[n]
+	}
+	return -1
+}
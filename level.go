@@ -0,0 +1,44 @@
+//go:build go1.21
+
+package actionslog
+
+import (
+	"log/slog"
+	"os"
+)
+
+// RunnerDebug returns true when the RUNNER_DEBUG environment variable is "1". GitHub sets it when a job
+// is run with debug logging enabled.
+func RunnerDebug() bool {
+	return os.Getenv("RUNNER_DEBUG") == "1"
+}
+
+// RunnerLevel is a slog.Leveler that resolves to slog.LevelDebug when RunnerDebug returns true and to
+// Default otherwise. RUNNER_DEBUG is checked every time Level is called. RunnerLevel can be used as the
+// Level for both Wrapper and human.Handler.
+type RunnerLevel struct {
+	// Default is the level when RUNNER_DEBUG isn't set. Defaults to slog.LevelInfo.
+	Default slog.Leveler
+}
+
+func (l RunnerLevel) Level() slog.Level {
+	if RunnerDebug() {
+		return slog.LevelDebug
+	}
+	if l.Default == nil {
+		return slog.LevelInfo
+	}
+	return l.Default.Level()
+}
+
+// RunnerDebugActionsLog is an alternative to DefaultActionsLog that only writes ::debug commands when
+// RunnerDebug returns true. Otherwise, debug records are written as plain log lines. GitHub hides
+// ::debug messages unless debug logging is enabled, so this keeps debug records visible when they are
+// enabled by some other means.
+func RunnerDebugActionsLog(level slog.Level) ActionsLog {
+	actionsLog := DefaultActionsLog(level)
+	if actionsLog == LogDebug && !RunnerDebug() {
+		return LogPlain
+	}
+	return actionsLog
+}
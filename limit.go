@@ -0,0 +1,53 @@
+//go:build go1.21
+
+package actionslog
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// overLimit counts an annotation of kind actionsLog and returns true if it exceeds AnnotationLimit.
+// Only call overLimit on the root Wrapper while holding its mux.
+func (w *Wrapper) overLimit(actionsLog ActionsLog) bool {
+	if actionsLog == LogDebug || actionsLog == LogPlain || w.AnnotationLimit <= 0 {
+		return false
+	}
+	if w.annotations[actionsLog] < w.AnnotationLimit {
+		if w.annotations == nil {
+			w.annotations = map[ActionsLog]int{}
+		}
+		w.annotations[actionsLog]++
+		return false
+	}
+	if w.suppressed == nil {
+		w.suppressed = map[ActionsLog]int{}
+	}
+	w.suppressed[actionsLog]++
+	return true
+}
+
+// ReportSuppressed writes a line to the Wrapper's Output saying how many records were written as plain
+// log lines instead of annotations because of AnnotationLimit. It writes nothing if no annotations were
+// suppressed. Call it once at the end of the run.
+func (w *Wrapper) ReportSuppressed() error {
+	w.init()
+	root := w.root()
+	root.mux.Lock()
+	defer root.mux.Unlock()
+	var counts []string
+	for _, kind := range []ActionsLog{LogError, LogWarn, LogNotice} {
+		if n := root.suppressed[kind]; n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, kind))
+		}
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(root.output(), fmt.Sprintf(
+		"Reached the limit of %d annotations of each kind. Wrote %s records as plain log lines instead.\n",
+		root.AnnotationLimit, strings.Join(counts, ", "),
+	))
+	return err
+}
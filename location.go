@@ -0,0 +1,86 @@
+//go:build go1.21
+
+package actionslog
+
+import (
+	"bytes"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// Location is an explicit location for the annotation the Wrapper writes for a log record. Use it to
+// annotate files that aren't Go source such as configuration files or SQL migrations.
+//
+// Like Properties, Location values are found in a record's attributes and in attributes added with
+// WithAttrs regardless of the attribute's key, and they are removed before the record is passed to the
+// Wrapper's Handler. A Location overrides the location derived from the record's PC and is used even
+// when AddSource is false. When more than one Location applies to a record, the last one wins. Non-zero
+// fields from Properties override Col, EndLine and EndColumn.
+type Location struct {
+	// File is the path of the file to annotate. Relative paths are used as-is and should be relative
+	// to the root of the repository. Absolute paths are made relative to the workspace the same way
+	// source file paths are. The file and line are omitted when an absolute path is outside the
+	// workspace.
+	File string
+
+	// Line is the line where the annotation starts.
+	Line int
+
+	// Col is the column where the annotation starts.
+	Col int
+
+	// EndLine is the line where the annotation ends.
+	EndLine int
+
+	// EndColumn is the column where the annotation ends.
+	EndColumn int
+}
+
+// OffsetLocation returns a Location in file for the bytes of content from offset start up to offset end.
+// content is the content of file. Lines and columns start at 1, and columns count runes. EndLine and
+// EndColumn point to the last rune in the range. They are zero when end <= start. Offsets are clamped to
+// the bounds of content.
+func OffsetLocation(file string, content []byte, start, end int) Location {
+	start = clampOffset(start, content)
+	end = clampOffset(end, content)
+	loc := Location{File: file}
+	loc.Line, loc.Col = OffsetPosition(content, start)
+	if end > start {
+		_, size := utf8.DecodeLastRune(content[:end])
+		loc.EndLine, loc.EndColumn = OffsetPosition(content, end-size)
+	}
+	return loc
+}
+
+// OffsetPosition returns the line and column of the rune at offset in content. Lines and columns start
+// at 1, and columns count runes. offset is clamped to the bounds of content.
+func OffsetPosition(content []byte, offset int) (line, col int) {
+	offset = clampOffset(offset, content)
+	before := content[:offset]
+	lineStart := bytes.LastIndexByte(before, '\n') + 1
+	line = bytes.Count(before, []byte{'\n'}) + 1
+	col = utf8.RuneCount(before[lineStart:]) + 1
+	return line, col
+}
+
+func clampOffset(offset int, content []byte) int {
+	if offset < 0 {
+		return 0
+	}
+	if offset > len(content) {
+		return len(content)
+	}
+	return offset
+}
+
+// locationFile returns the path to use in the file property for a Location's File. ok is false when
+// file is empty or is an absolute path that can't be mapped to a file in the repository.
+func (w *Wrapper) locationFile(file string) (_ string, ok bool) {
+	if file == "" {
+		return "", false
+	}
+	if !filepath.IsAbs(file) {
+		return filepath.ToSlash(file), true
+	}
+	return w.sourceFile(file)
+}
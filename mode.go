@@ -0,0 +1,33 @@
+//go:build go1.21
+
+package actionslog
+
+import "os"
+
+// Mode determines whether a Wrapper formats its output for GitHub Actions.
+type Mode int
+
+const (
+	// ModeActions formats output as GitHub Actions workflow commands. This is the default.
+	ModeActions Mode = iota
+
+	// ModeAuto uses ModeActions when the GITHUB_ACTIONS environment variable is "true" and ModeLocal
+	// otherwise.
+	ModeAuto
+
+	// ModeLocal passes records directly to the Wrapper's Handler, which writes to the Wrapper's
+	// LocalOutput. This keeps logs readable when running outside of GitHub Actions.
+	ModeLocal
+)
+
+// isLocal returns true if m resolves to ModeLocal.
+func (m Mode) isLocal() bool {
+	switch m {
+	case ModeLocal:
+		return true
+	case ModeAuto:
+		return os.Getenv("GITHUB_ACTIONS") != "true"
+	default:
+		return false
+	}
+}
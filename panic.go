@@ -0,0 +1,95 @@
+//go:build go1.21
+
+package actionslog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// RecoverAndReport recovers from a panic, logs it to logger at slog.LevelError and then panics again
+// with the same value. It must be called directly with defer, usually at the top of main or of a
+// goroutine:
+//
+//	defer actionslog.RecoverAndReport(logger)
+//
+// When logger's handler is a *Wrapper, the panic is written as an ::error annotation pointing at the
+// line that panicked, and the goroutine's stack is written as plain log lines in a collapsed group.
+// Other handlers get the stack as a "stack" attribute.
+func RecoverAndReport(logger *slog.Logger) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	reportPanic(logger, r)
+	panic(r)
+}
+
+// RecoverAndExit is like RecoverAndReport, but it exits with code instead of panicking again.
+func RecoverAndExit(logger *slog.Logger, code int) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	reportPanic(logger, r)
+	os.Exit(code)
+}
+
+func reportPanic(logger *slog.Logger, value any) {
+	ctx := context.Background()
+	handler := logger.Handler()
+	if !handler.Enabled(ctx, slog.LevelError) {
+		return
+	}
+	stack := debug.Stack()
+	pcs := panicStack()
+	var pc uintptr
+	if len(pcs) > 0 {
+		pc = pcs[0]
+	}
+	record := slog.NewRecord(time.Now(), slog.LevelError, fmt.Sprintf("panic: %v", value), pc)
+	w, ok := handler.(*Wrapper)
+	if ok {
+		w.init()
+		ok = !w.root().local
+	}
+	if !ok {
+		record.AddAttrs(slog.String("stack", string(stack)))
+		_ = handler.Handle(ctx, record)
+		return
+	}
+	// The panicking frame is used even without AddSource because it is the most useful thing to link to.
+	frame, found := w.sourceFrame(pcs)
+	if found {
+		record.AddAttrs(slog.Any("", Location{File: frame.File, Line: frame.Line}))
+	}
+	_ = w.Handle(ctx, record)
+	end := w.Group("Stack trace")
+	_ = w.writeLines(stack)
+	end()
+}
+
+// panicStack returns the stack of the panicking goroutine starting at the function that panicked. It
+// must be called from a deferred function while the goroutine is panicking.
+func panicStack() []uintptr {
+	pcs := make([]uintptr, 64)
+	pcs = pcs[:runtime.Callers(1, pcs)]
+	panicking := false
+	for i := range pcs {
+		frame, _ := runtime.CallersFrames(pcs[i : i+1]).Next()
+		if frame.Function == "runtime.gopanic" {
+			panicking = true
+			continue
+		}
+		if panicking && !strings.HasPrefix(frame.Function, "runtime.") {
+			return pcs[i:]
+		}
+	}
+	return nil
+}
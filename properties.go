@@ -0,0 +1,150 @@
+//go:build go1.21
+
+package actionslog
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// Properties are optional properties for the annotation the Wrapper writes for a log record.
+//
+// The Wrapper looks for Properties values in a record's attributes and in attributes added
+// with WithAttrs. The attribute's key doesn't matter, so slog.Any("", Properties{...}) works
+// fine. Properties attributes are removed before the record is passed to the Wrapper's Handler.
+// When more than one Properties value applies to a record, non-zero fields from later values
+// override earlier ones.
+type Properties struct {
+	// Title is a custom title for the annotation. Leading and trailing white space is removed
+	// because GitHub would drop it anyway.
+	Title string
+
+	// Col is the column where the annotation starts.
+	Col int
+
+	// EndLine is the line where the annotation ends.
+	EndLine int
+
+	// EndColumn is the column where the annotation ends.
+	EndColumn int
+}
+
+// merge returns p with the non-zero fields of o applied.
+func (p Properties) merge(o Properties) Properties {
+	if o.Title != "" {
+		p.Title = o.Title
+	}
+	if o.Col != 0 {
+		p.Col = o.Col
+	}
+	if o.EndLine != 0 {
+		p.EndLine = o.EndLine
+	}
+	if o.EndColumn != 0 {
+		p.EndColumn = o.EndColumn
+	}
+	return p
+}
+
+// annotationAttrs are the Properties and Location found in a record's attributes.
+type annotationAttrs struct {
+	properties Properties
+	location   Location
+}
+
+// add merges attr into a when it is a Properties or Location attribute. ok is false for other attributes.
+func (a annotationAttrs) add(attr slog.Attr) (_ annotationAttrs, ok bool) {
+	if attr.Value.Kind() != slog.KindAny {
+		return a, false
+	}
+	switch v := attr.Value.Any().(type) {
+	case Properties:
+		a.properties = a.properties.merge(v)
+	case Location:
+		a.location = v
+	default:
+		return a, false
+	}
+	return a, true
+}
+
+// extractAnnotationAttrs returns attrs with any Properties and Location attributes removed along with
+// the result of adding the removed attributes to a. attrs is modified in place.
+func extractAnnotationAttrs(a annotationAttrs, attrs []slog.Attr) (annotationAttrs, []slog.Attr) {
+	kept := attrs[:0]
+	for _, attr := range attrs {
+		var ok bool
+		a, ok = a.add(attr)
+		if !ok {
+			kept = append(kept, attr)
+		}
+	}
+	return a, kept
+}
+
+// appendProperty appends a workflow command property to dst. start is the position in dst where
+// the command's properties begin. It is used to decide whether a separator is needed.
+func appendProperty(dst []byte, start int, key, value string) []byte {
+	if len(dst) > start {
+		dst = append(dst, ',')
+	}
+	dst = append(dst, key...)
+	dst = append(dst, '=')
+	return appendEscapedProperty(dst, value)
+}
+
+// appendEscapedProperty appends value to dst escaped the way GitHub expects workflow command
+// property values to be escaped.
+func appendEscapedProperty(dst []byte, value string) []byte {
+	for len(value) > 0 {
+		i := strings.IndexAny(value, "%\r\n:,")
+		if i < 0 {
+			return append(dst, value...)
+		}
+		dst = append(dst, value[:i]...)
+		switch value[i] {
+		case '%':
+			dst = append(dst, "%25"...)
+		case '\r':
+			dst = append(dst, "%0D"...)
+		case '\n':
+			dst = append(dst, "%0A"...)
+		case ':':
+			dst = append(dst, "%3A"...)
+		case ',':
+			dst = append(dst, "%2C"...)
+		}
+		value = value[i+1:]
+	}
+	return dst
+}
+
+func appendIntProperty(dst []byte, start int, key string, value int) []byte {
+	if value <= 0 {
+		return dst
+	}
+	return appendProperty(dst, start, key, strconv.Itoa(value))
+}
+
+// recordAnnotationAttrs returns record with any Properties and Location attributes removed along with
+// the result of adding the removed attributes to a.
+func recordAnnotationAttrs(a annotationAttrs, record slog.Record) (annotationAttrs, slog.Record) {
+	found := false
+	record.Attrs(func(attr slog.Attr) bool {
+		_, found = annotationAttrs{}.add(attr)
+		return !found
+	})
+	if !found {
+		return a, record
+	}
+	attrs := make([]slog.Attr, 0, record.NumAttrs())
+	record.Attrs(func(attr slog.Attr) bool {
+		attrs = append(attrs, attr)
+		return true
+	})
+	a, attrs = extractAnnotationAttrs(a, attrs)
+	stripped := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	stripped.AddAttrs(attrs...)
+	return a, stripped
+}
@@ -0,0 +1,107 @@
+//go:build go1.21
+
+package actionslog
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/willabides/actionslog/internal/yamlquote"
+)
+
+// Secret is a string that should be masked in the GitHub Actions log.
+//
+// The first time a Wrapper sees a Secret in a record's attributes or in attributes added with
+// WithAttrs, it writes an ::add-mask:: command for it before writing the record. GitHub then
+// replaces the value with "***" everywhere it appears in the log. The Wrapper finds Secrets in
+// groups and in values returned by other LogValuers, but not in fields of arbitrary structs.
+//
+// Secret only hides the value when it is logged through a Wrapper. Other handlers will write it
+// as-is.
+type Secret string
+
+// LogValue implements slog.LogValuer.
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(string(s))
+}
+
+// maxLogValuerDepth is how many LogValuers appendSecrets will follow. It matches the limit in slog's
+// Value.Resolve.
+const maxLogValuerDepth = 100
+
+// appendSecrets appends the values of any Secrets found in attrs to secrets.
+func appendSecrets(secrets []string, attrs ...slog.Attr) []string {
+	for _, attr := range attrs {
+		secrets = appendValueSecrets(secrets, attr.Value)
+	}
+	return secrets
+}
+
+func appendValueSecrets(secrets []string, v slog.Value) []string {
+	for i := 0; i < maxLogValuerDepth && v.Kind() == slog.KindLogValuer; i++ {
+		lv := v.LogValuer()
+		if s, ok := lv.(Secret); ok {
+			return append(secrets, string(s))
+		}
+		var ok bool
+		v, ok = logValue(lv)
+		if !ok {
+			return secrets
+		}
+	}
+	if v.Kind() == slog.KindGroup {
+		for _, attr := range v.Group() {
+			secrets = appendValueSecrets(secrets, attr.Value)
+		}
+	}
+	return secrets
+}
+
+// logValue calls lv.LogValue. ok is false if it panics. The handler will deal with the panic when it
+// resolves the value.
+func logValue(lv slog.LogValuer) (_ slog.Value, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	return lv.LogValue(), true
+}
+
+// writeMasks writes ::add-mask:: commands for any secrets that haven't been masked yet. GitHub masks
+// multi-line values one line at a time, so each line is masked separately. Surrounding white space is
+// trimmed from each line because handlers may trim it from values. Lines that handlers would escape
+// when quoting them are also masked in their escaped forms: Go's, which covers slog's handlers, and the
+// YAML escapes human.Handler uses. Only call writeMasks on the root Wrapper while holding its mux.
+func (w *Wrapper) writeMasks(secrets []string) error {
+	for _, secret := range secrets {
+		for _, line := range strings.Split(secret, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			goQuoted := strconv.Quote(line)
+			yamlQuoted := string(yamlquote.Append(nil, line))
+			for _, mask := range []string{
+				line,
+				goQuoted[1 : len(goQuoted)-1],
+				string(yamlquote.AppendEscaped(nil, line)),
+				yamlQuoted[1 : len(yamlQuoted)-1],
+			} {
+				if _, ok := w.masked[mask]; ok {
+					continue
+				}
+				if w.masked == nil {
+					w.masked = map[string]struct{}{}
+				}
+				w.masked[mask] = struct{}{}
+				err := w.writeCommand("add-mask", mask)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
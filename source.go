@@ -0,0 +1,144 @@
+//go:build go1.21
+
+package actionslog
+
+import (
+	"log/slog"
+	"path"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/willabides/actionslog/internal/callers"
+)
+
+// PathRewrite rewrites source file paths that start with Prefix so that they start with Replacement
+// instead. Prefix only matches whole path elements, so "example.com/foo" matches "example.com/foo/bar.go"
+// but not "example.com/foobar/baz.go". An empty Replacement removes Prefix and the slash after it.
+//
+// A path that is relative after rewriting is assumed to be relative to the root of the repository.
+// A path that is absolute after rewriting is made relative to the Wrapper's Workspace.
+type PathRewrite struct {
+	Prefix      string
+	Replacement string
+}
+
+// rewrite applies r to file. ok is false when r doesn't match file.
+func (r PathRewrite) rewrite(file string) (_ string, ok bool) {
+	prefix := strings.TrimSuffix(r.Prefix, "/")
+	if prefix == "" || !strings.HasPrefix(file, prefix) {
+		return "", false
+	}
+	rest := file[len(prefix):]
+	if rest != "" && rest[0] != '/' {
+		return "", false
+	}
+	if r.Replacement == "" {
+		// path.Join would keep the leading slash and make the path absolute
+		return strings.TrimPrefix(rest, "/"), true
+	}
+	return path.Join(r.Replacement, rest), true
+}
+
+var (
+	mainModuleRewrite     PathRewrite
+	mainModuleRewriteOnce sync.Once
+)
+
+// mainModuleRewriter returns a PathRewrite that strips the main module's path from file names. This
+// is the form file names take in binaries built with -trimpath.
+func mainModuleRewriter() PathRewrite {
+	mainModuleRewriteOnce.Do(func() {
+		info, ok := debug.ReadBuildInfo()
+		if ok {
+			mainModuleRewrite.Prefix = info.Main.Path
+		}
+	})
+	return mainModuleRewrite
+}
+
+// recordFrame returns the frame to use for record's annotation location. It is the first frame from the
+// stack of an error attribute that is in the repository or, when there is none, the frame for record.PC.
+// File and Line are zeroed when the frame's file can't be mapped to a file in the repository.
+func (w *Wrapper) recordFrame(record slog.Record) runtime.Frame {
+	if stack := recordErrorStack(record); len(stack) > 0 {
+		frame, ok := w.sourceFrame(stack)
+		if ok {
+			return frame
+		}
+	}
+	frame := callers.Frame(record.PC)
+	file, ok := w.sourceFile(frame.File)
+	if !ok {
+		frame.File = ""
+		frame.Line = 0
+		return frame
+	}
+	frame.File = file
+	return frame
+}
+
+// sourceFrame returns the first frame from pcs that isn't a helper and can be mapped to a file in the
+// repository with File rewritten to the path that should be used in the annotation's file property. When
+// there is no such frame, it returns the first frame with File and Line zeroed.
+func (w *Wrapper) sourceFrame(pcs []uintptr) (_ runtime.Frame, ok bool) {
+	frames := runtime.CallersFrames(pcs)
+	var first runtime.Frame
+	for i := 0; ; i++ {
+		frame, more := frames.Next()
+		if i == 0 {
+			first = frame
+		}
+		file, ok := w.sourceFile(frame.File)
+		if ok && !callers.IsHelper(frame.Function) {
+			frame.File = file
+			return frame, true
+		}
+		if !more {
+			break
+		}
+	}
+	first.File = ""
+	first.Line = 0
+	return first, false
+}
+
+// sourceFile rewrites file to be relative to the root of the repository. ok is false when file
+// can't be mapped to a file in the repository.
+func (w *Wrapper) sourceFile(file string) (_ string, ok bool) {
+	if file == "" {
+		return "", false
+	}
+	root := w.root()
+	rewritten := false
+	for _, r := range root.PathRewrites {
+		var f string
+		f, rewritten = r.rewrite(file)
+		if rewritten {
+			file = f
+			break
+		}
+	}
+	if !rewritten {
+		var f string
+		f, rewritten = mainModuleRewriter().rewrite(file)
+		if rewritten {
+			file = f
+		}
+	}
+	if !filepath.IsAbs(filepath.FromSlash(file)) {
+		// Paths built with -trimpath are relative. The ones we didn't rewrite are from GOROOT or
+		// the module cache.
+		return file, rewritten
+	}
+	if root.workspace == "" {
+		return file, true
+	}
+	rel, err := filepath.Rel(root.workspace, filepath.FromSlash(file))
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
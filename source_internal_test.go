@@ -0,0 +1,39 @@
+//go:build go1.21
+
+package actionslog
+
+import (
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceFile(t *testing.T) {
+	t.Run("main module", func(t *testing.T) {
+		info, ok := debug.ReadBuildInfo()
+		if !ok || info.Main.Path == "" {
+			t.Skip("test binary has no main module")
+		}
+		mainPath := info.Main.Path
+		for _, workspace := range []string{"", "/home/runner/work/repo/repo"} {
+			t.Setenv("GITHUB_WORKSPACE", "")
+			w := &Wrapper{Workspace: workspace}
+			w.init()
+			got, ok := w.sourceFile(mainPath + "/pkg/x.go")
+			require.True(t, ok, workspace)
+			require.Equal(t, "pkg/x.go", got, workspace)
+		}
+	})
+
+	t.Run("empty Replacement", func(t *testing.T) {
+		w := &Wrapper{
+			Workspace:    "/home/runner/work/repo/repo",
+			PathRewrites: []PathRewrite{{Prefix: "example.com/org/repo/"}},
+		}
+		w.init()
+		got, ok := w.sourceFile("example.com/org/repo/pkg/x.go")
+		require.True(t, ok)
+		require.Equal(t, "pkg/x.go", got)
+	})
+}
@@ -0,0 +1,54 @@
+//go:build go1.21
+
+package actionslog
+
+import "log/slog"
+
+// count counts a handled record of kind actionsLog. Only call count on the root Wrapper while holding
+// its mux.
+func (w *Wrapper) count(actionsLog ActionsLog) {
+	if w.stats == nil {
+		w.stats = map[ActionsLog]int{}
+	}
+	w.stats[actionsLog]++
+}
+
+// Stats returns the number of records the Wrapper and the handlers derived from it have handled by the
+// ActionsLog kind they were mapped to. Records written as plain log lines because of AnnotationLimit
+// are counted as the kind they were mapped to. Records are counted in ModeLocal too.
+func (w *Wrapper) Stats() map[ActionsLog]int {
+	w.init()
+	root := w.root()
+	root.mux.Lock()
+	defer root.mux.Unlock()
+	stats := make(map[ActionsLog]int, len(root.stats))
+	for k, v := range root.stats {
+		stats[k] = v
+	}
+	return stats
+}
+
+// Failed returns true if the Wrapper or the handlers derived from it have handled a record that was
+// mapped to LogError, or to LogWarn when FailOnWarning is set.
+func (w *Wrapper) Failed() bool {
+	w.init()
+	root := w.root()
+	root.mux.Lock()
+	defer root.mux.Unlock()
+	if root.stats[LogError] > 0 {
+		return true
+	}
+	return root.FailOnWarning && root.stats[LogWarn] > 0
+}
+
+// ExitCode returns 1 if handler is a Wrapper that has Failed and 0 otherwise. It is meant to be used
+// at the end of main like this:
+//
+//	os.Exit(actionslog.ExitCode(logger.Handler()))
+func ExitCode(handler slog.Handler) int {
+	w, ok := handler.(*Wrapper)
+	if !ok || !w.Failed() {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,128 @@
+//go:build go1.21
+
+package actionslog
+
+import (
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedirectStdLog makes the standard library's default logger write records at level to handler and
+// returns a function that restores the previous output and flags.
+//
+// Unlike slog.NewLogLogger, the records' PC is that of the function that called the log package, so
+// source locations point at the call site. When the logger's flags include log.Lshortfile or
+// log.Llongfile, the "file.go:12: " prefix is removed from the message and is used to find the call
+// site on the stack, which accounts for log.Output's calldepth. A long file name that isn't on the
+// stack is used as the record's Location.
+//
+// The date and time flags are cleared because records have their own time. The default logger's
+// flags and prefix should not be changed until restore is called.
+func RedirectStdLog(handler slog.Handler, level slog.Level) (restore func()) {
+	output := log.Writer()
+	flags := log.Flags()
+	log.SetFlags(flags &^ (log.Ldate | log.Ltime | log.Lmicroseconds | log.LUTC))
+	log.SetOutput(&stdLogWriter{
+		handler: handler,
+		level:   level,
+		flags:   log.Flags(),
+		prefix:  log.Prefix(),
+	})
+	return func() {
+		log.SetOutput(output)
+		log.SetFlags(flags)
+	}
+}
+
+// stdLogWriter is the io.Writer that RedirectStdLog sets as the default logger's output. Each Write is
+// one log entry.
+type stdLogWriter struct {
+	handler slog.Handler
+	level   slog.Level
+	flags   int
+	prefix  string
+}
+
+var _ io.Writer = (*stdLogWriter)(nil)
+
+func (w *stdLogWriter) Write(p []byte) (int, error) {
+	ctx := context.Background()
+	if !w.handler.Enabled(ctx, w.level) {
+		return len(p), nil
+	}
+	msg := strings.TrimSuffix(string(p), "\n")
+	var file string
+	var line int
+	if w.flags&(log.Lshortfile|log.Llongfile) != 0 {
+		if w.flags&log.Lmsgprefix == 0 {
+			msg = strings.TrimPrefix(msg, w.prefix)
+		}
+		file, line, msg = cutFileLine(msg)
+		if w.flags&log.Lmsgprefix == 0 {
+			msg = w.prefix + msg
+		}
+	}
+	pc, found := stdLogCaller(file, line, w.flags&log.Lshortfile != 0)
+	record := slog.NewRecord(time.Now(), w.level, msg, pc)
+	if !found && filepath.IsAbs(file) {
+		record.AddAttrs(slog.Any("", Location{File: file, Line: line}))
+	}
+	err := w.handler.Handle(ctx, record)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// cutFileLine splits the "file.go:12: " prefix the log package writes for log.Lshortfile and
+// log.Llongfile from msg. file is empty when msg doesn't have the prefix.
+func cutFileLine(msg string) (file string, line int, rest string) {
+	loc, rest, ok := strings.Cut(msg, ": ")
+	if !ok {
+		return "", 0, msg
+	}
+	i := strings.LastIndexByte(loc, ':')
+	if i < 0 {
+		return "", 0, msg
+	}
+	line, err := strconv.Atoi(loc[i+1:])
+	if err != nil {
+		return "", 0, msg
+	}
+	return loc[:i], line, rest
+}
+
+// stdLogCaller returns the PC of the caller of the log package. When file is set, it looks for the frame
+// at file and line, comparing only the base name when short is true. found is false when there is no
+// such frame, in which case pc is the first caller outside the log package.
+func stdLogCaller(file string, line int, short bool) (pc uintptr, found bool) {
+	pcs := make([]uintptr, 64)
+	pcs = pcs[:runtime.Callers(3, pcs)]
+	for i := range pcs {
+		frame, _ := runtime.CallersFrames(pcs[i : i+1]).Next()
+		if strings.HasPrefix(frame.Function, "log.") {
+			continue
+		}
+		if pc == 0 {
+			pc = pcs[i]
+		}
+		if file == "" {
+			return pc, false
+		}
+		frameFile := frame.File
+		if short {
+			frameFile = filepath.Base(frameFile)
+		}
+		if frameFile == file && frame.Line == line {
+			return pcs[i], true
+		}
+	}
+	return pc, false
+}
@@ -0,0 +1,91 @@
+//go:build go1.21
+
+package actionslog_test
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/actionslog"
+)
+
+func TestRedirectStdLog(t *testing.T) {
+	_, thisFile, _, _ := runtime.Caller(0)
+	fileName := filepath.Base(thisFile)
+	newHandler := func(buf *bytes.Buffer) slog.Handler {
+		return &actionslog.Wrapper{
+			Output:    buf,
+			AddSource: true,
+			Workspace: filepath.Dir(thisFile),
+		}
+	}
+
+	t.Run("default flags", func(t *testing.T) {
+		var buf bytes.Buffer
+		restore := actionslog.RedirectStdLog(newHandler(&buf), slog.LevelWarn)
+		_, _, wantLine, _ := runtime.Caller(0)
+		log.Printf("hello %s", "world")
+		wantLine++
+		restore()
+		require.Equal(t, log.LstdFlags, log.Flags())
+		require.Equal(t, "::warning file="+fileName+",line="+strconv.Itoa(wantLine)+"::msg=\"hello world\"\n", buf.String())
+	})
+
+	t.Run("Lshortfile", func(t *testing.T) {
+		log.SetFlags(log.LstdFlags | log.Lshortfile)
+		log.SetPrefix("dep: ")
+		t.Cleanup(func() {
+			log.SetFlags(log.LstdFlags)
+			log.SetPrefix("")
+		})
+		var buf bytes.Buffer
+		restore := actionslog.RedirectStdLog(newHandler(&buf), slog.LevelInfo)
+		defer restore()
+		_, _, wantLine, _ := runtime.Caller(0)
+		log.Print("hello")
+		logOutput("from helper")
+		wantLine++
+		require.Equal(t, "::notice file="+fileName+",line="+strconv.Itoa(wantLine)+"::msg=\"dep: hello\"\n"+
+			"::notice file="+fileName+",line="+strconv.Itoa(wantLine+1)+"::msg=\"dep: from helper\"\n",
+			buf.String())
+	})
+
+	t.Run("Llongfile with Lmsgprefix", func(t *testing.T) {
+		log.SetFlags(log.Llongfile | log.Lmsgprefix)
+		log.SetPrefix("dep: ")
+		t.Cleanup(func() {
+			log.SetFlags(log.LstdFlags)
+			log.SetPrefix("")
+		})
+		var buf bytes.Buffer
+		restore := actionslog.RedirectStdLog(newHandler(&buf), slog.LevelInfo)
+		defer restore()
+		_, _, wantLine, _ := runtime.Caller(0)
+		log.Print("hello")
+		wantLine++
+		require.Equal(t, "::notice file="+fileName+",line="+strconv.Itoa(wantLine)+"::msg=\"dep: hello\"\n", buf.String())
+	})
+
+	t.Run("disabled level", func(t *testing.T) {
+		var buf bytes.Buffer
+		restore := actionslog.RedirectStdLog(&actionslog.Wrapper{
+			Output: &buf,
+			Level:  slog.LevelInfo,
+		}, slog.LevelDebug)
+		defer restore()
+		log.Print("hello")
+		require.Empty(t, buf.String())
+	})
+}
+
+// logOutput logs msg with the location of its caller the way logging helpers in other packages do.
+func logOutput(msg string) {
+	_ = log.Output(2, fmt.Sprint(msg))
+}
@@ -0,0 +1,207 @@
+//go:build go1.21
+
+package actionslog
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/willabides/actionslog/human"
+)
+
+// SummaryHandler is a slog.Handler that appends log records to the job summary as Markdown. Each record
+// is written as a heading with the record's level and message followed by a collapsible <details> block
+// containing the record's attributes.
+type SummaryHandler struct {
+	// Path is the file to append to. Defaults to the GITHUB_STEP_SUMMARY environment variable. When neither
+	// is set, SummaryHandler discards all records. Path should not be changed after the SummaryHandler is
+	// created.
+	Path string
+
+	// Level is the minimum level to write. Defaults to slog.LevelWarn so that the summary isn't cluttered
+	// with routine messages.
+	Level slog.Leveler
+
+	// Handler is a function that returns the handler used to format attributes. Handler is only called once,
+	// so changes after the SummaryHandler is created will not be reflected. The record passed to it has an
+	// empty message. Defaults to a human.Handler that excludes time and level.
+	Handler func(w io.Writer) slog.Handler
+
+	parent *SummaryHandler
+
+	// path is the resolved Path. Only the root's path is used.
+	path string
+
+	// only the root's buf is used.
+	buf *[]byte
+
+	handler slog.Handler
+
+	// mux should only be accessed on the root SummaryHandler.
+	mux sync.Mutex
+
+	initOnce sync.Once
+}
+
+func (s *SummaryHandler) init() {
+	s.initOnce.Do(func() {
+		if s.parent != nil {
+			s.parent.init()
+			return
+		}
+		s.path = s.Path
+		if s.path == "" {
+			s.path = os.Getenv("GITHUB_STEP_SUMMARY")
+		}
+		buf := make([]byte, 0, 1024)
+		s.buf = &buf
+		handler := s.Handler
+		if handler == nil {
+			handler = defaultSummaryHandler
+		}
+		s.handler = handler(&appendWriter{buf: s.buf})
+	})
+}
+
+func defaultSummaryHandler(w io.Writer) slog.Handler {
+	return &human.Handler{
+		Output:       w,
+		Level:        slog.Level(math.MinInt),
+		ExcludeTime:  true,
+		ExcludeLevel: true,
+	}
+}
+
+func (s *SummaryHandler) root() *SummaryHandler {
+	root := s
+	for root.parent != nil {
+		root = root.parent
+	}
+	return root
+}
+
+func (s *SummaryHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	s.init()
+	if s.root().path == "" {
+		return false
+	}
+	minLevel := slog.LevelWarn
+	if s.Level != nil {
+		minLevel = s.Level.Level()
+	}
+	if level < minLevel {
+		return false
+	}
+	return s.handler.Enabled(ctx, level)
+}
+
+func (s *SummaryHandler) Handle(ctx context.Context, record slog.Record) error {
+	s.init()
+	root := s.root()
+	if root.path == "" {
+		return nil
+	}
+	root.mux.Lock()
+	defer root.mux.Unlock()
+
+	*root.buf = (*root.buf)[:0]
+	attrsRecord := slog.NewRecord(record.Time, record.Level, "", record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		attrsRecord.AddAttrs(attr)
+		return true
+	})
+	err := s.handler.Handle(ctx, attrsRecord)
+	if err != nil {
+		return err
+	}
+	attrs := bytes.Trim(*root.buf, "\r\n")
+
+	var md strings.Builder
+	md.WriteString("#### ")
+	md.WriteString(record.Level.String())
+	md.WriteString(": ")
+	for i, line := range strings.Split(strings.TrimRight(record.Message, "\r\n"), "\n") {
+		if i > 0 {
+			md.WriteString("<br>")
+		}
+		md.WriteString(escapeMarkdown(strings.TrimSuffix(line, "\r")))
+	}
+	md.WriteString("\n\n")
+	if len(bytes.TrimSpace(attrs)) > 0 {
+		fence := markdownFence(attrs)
+		md.WriteString("<details><summary>Attributes</summary>\n\n")
+		md.WriteString(fence + "\n")
+		md.Write(attrs)
+		md.WriteString("\n" + fence + "\n\n</details>\n\n")
+	}
+
+	return appendToFile(root.path, md.String())
+}
+
+func (s *SummaryHandler) child(fn func(slog.Handler) slog.Handler) *SummaryHandler {
+	return &SummaryHandler{
+		parent:  s,
+		Level:   s.Level,
+		handler: fn(s.handler),
+	}
+}
+
+func (s *SummaryHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	s.init()
+	return s.child(func(h slog.Handler) slog.Handler {
+		return h.WithAttrs(attrs)
+	})
+}
+
+func (s *SummaryHandler) WithGroup(name string) slog.Handler {
+	s.init()
+	return s.child(func(h slog.Handler) slog.Handler {
+		return h.WithGroup(name)
+	})
+}
+
+type appendWriter struct {
+	buf *[]byte
+}
+
+func (a *appendWriter) Write(p []byte) (int, error) {
+	*a.buf = append(*a.buf, p...)
+	return len(p), nil
+}
+
+// escapeMarkdown escapes ASCII punctuation in s so that it is rendered as-is.
+func escapeMarkdown(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte("\\`*_{}[]<>()#+-.!|~&", s[i]) >= 0 {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// markdownFence returns a code fence that is longer than any run of backticks in content.
+func markdownFence(content []byte) string {
+	longest, run := 0, 0
+	for _, b := range content {
+		if b != '`' {
+			run = 0
+			continue
+		}
+		run++
+		if run > longest {
+			longest = run
+		}
+	}
+	if longest < 3 {
+		return "```"
+	}
+	return strings.Repeat("`", longest+1)
+}
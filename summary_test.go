@@ -0,0 +1,92 @@
+//go:build go1.21
+
+package actionslog_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/actionslog"
+)
+
+func TestSummaryHandler(t *testing.T) {
+	t.Run("basic", func(t *testing.T) {
+		summaryFile := filepath.Join(t.TempDir(), "summary.md")
+		t.Setenv("GITHUB_STEP_SUMMARY", summaryFile)
+		logger := slog.New(&actionslog.SummaryHandler{})
+		logger = logger.With(slog.String("foo", "bar"))
+		logger.Info("not in summary")
+		logger.Warn("something *odd*\nhappened")
+		logger.WithGroup("g").Error("got an error", slog.Any("err", fmt.Errorf("omg")), slog.String("code", "```"))
+		got, err := os.ReadFile(summaryFile)
+		require.NoError(t, err)
+		requireEqualString(t, "#### WARN: something \\*odd\\*<br>happened\n"+`
+<details><summary>Attributes</summary>
+
+`+"```"+`
+  foo: bar
+`+"```"+`
+
+</details>
+
+#### ERROR: got an error
+
+<details><summary>Attributes</summary>
+
+`+"````"+`
+  foo: bar
+  g:
+    err: omg
+    code: "`+"```"+`"
+`+"````"+`
+
+</details>
+
+`, string(got))
+	})
+
+	t.Run("no attributes", func(t *testing.T) {
+		summaryFile := filepath.Join(t.TempDir(), "summary.md")
+		logger := slog.New(&actionslog.SummaryHandler{
+			Path:  summaryFile,
+			Level: slog.LevelInfo,
+		})
+		logger.Info("hello")
+		got, err := os.ReadFile(summaryFile)
+		require.NoError(t, err)
+		requireEqualString(t, "#### INFO: hello\n\n", string(got))
+	})
+
+	t.Run("no path", func(t *testing.T) {
+		t.Setenv("GITHUB_STEP_SUMMARY", "")
+		handler := &actionslog.SummaryHandler{}
+		require.False(t, handler.Enabled(context.Background(), slog.LevelError))
+	})
+
+	t.Run("concurrency", func(t *testing.T) {
+		summaryFile := filepath.Join(t.TempDir(), "summary.md")
+		logger := slog.New(&actionslog.SummaryHandler{Path: summaryFile})
+		sub := logger.With(slog.String("sub", "sub"))
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func(i int) {
+				logger.Warn("hello", slog.Int("i", i))
+				sub.Warn("hello", slog.Int("i", i))
+				wg.Done()
+			}(i)
+		}
+		wg.Wait()
+		got, err := os.ReadFile(summaryFile)
+		require.NoError(t, err)
+		require.Equal(t, 200, strings.Count(string(got), "#### WARN: hello\n"))
+		require.Equal(t, 200, strings.Count(string(got), "</details>\n"))
+	})
+}